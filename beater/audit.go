@@ -0,0 +1,92 @@
+package beater
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/publisher"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+)
+
+// runAuditLogCollector collects the audit logs every audit_logs_period, alongside the configured input
+func (bt *Cloudflarebeat) runAuditLogCollector() {
+
+	logp.Info("Collecting the audit logs every %s", bt.config.AuditLogsPeriod)
+	ticker := time.NewTicker(bt.config.AuditLogsPeriod)
+	defer ticker.Stop()
+
+	for {
+		bt.CollectAuditLogs(time.Now().UTC())
+
+		select {
+		case <-bt.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectAuditLogs publishes the audit log entries which were added since the last published one and before timeNow,
+// page by page. The audit logs checkpoint of the state file is moved once each page is acknowledged by the output,
+// and the entries of the first page which were already published are dropped as the since parameter is inclusive.
+func (bt *Cloudflarebeat) CollectAuditLogs(timeNow time.Time) {
+
+	since := timeNow.Add(-bt.config.AuditLogsPeriod)
+	lastWhen, lastIDs := bt.state.GetAuditLogsCheckpoint()
+	if lastWhen != "" {
+		t, err := cloudflare.ParseAuditLogTime(lastWhen)
+		if err != nil {
+			logp.Err("Invalid audit logs checkpoint '%s' in the state file: %v", lastWhen, err)
+			return
+		}
+		since = t
+	}
+
+	filter := cloudflare.NewAuditLogFilter(since, lastIDs)
+	total, duplicates := 0, 0
+
+	for page := 1; ; page++ {
+		entries, err := bt.apiClient.GetAuditLogs(bt.config.AuditLogsAccountID, since, timeNow, page, bt.config.AuditLogsPageSize)
+		if err != nil {
+			logp.Err("Could not get the audit logs since %s, they will be retried: %v", since, err)
+			break
+		}
+
+		events := []common.MapStr{}
+		for _, al := range entries {
+			when, err := cloudflare.ParseAuditLogTime(al.When)
+			if err != nil {
+				logp.Warn("Skipping audit log entry %s: %v", al.ID, err)
+				continue
+			}
+			if !filter.Accept(when, al.ID) {
+				duplicates++
+				continue
+			}
+			events = append(events, cloudflare.BuildAuditMapStr(al, when))
+		}
+
+		if len(events) > 0 {
+			if !bt.client.PublishEvents(events, publisher.Sync) {
+				logp.Err("Could not publish the audit logs since %s, they will be retried", since)
+				break
+			}
+			when, ids := filter.Checkpoint()
+			bt.state.UpdateAuditLogsCheckpoint(when.UTC().Format(time.RFC3339Nano), ids)
+			total += len(events)
+		}
+
+		if len(entries) < bt.config.AuditLogsPageSize {
+			break
+		}
+	}
+
+	logp.Info("Published %d audit log entries since %s (%d duplicates dropped)", total, since, duplicates)
+
+	if total > 0 {
+		if err := bt.state.Save(); err != nil {
+			logp.Info("[ERROR] Could not persist state file to storage: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !integration
+// +build !integration
+
+package beater
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+// testAuditLogs serves the audit log entries between the since (inclusive) and before (exclusive) times, page by
+// page, failing the pages listed in failPages
+type testAuditLogs struct {
+	lock      sync.Mutex
+	entries   []cloudflare.AuditLog
+	failPages map[int]bool
+}
+
+func (s *testAuditLogs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q := r.URL.Query()
+	since, _ := time.Parse(time.RFC3339, q.Get("since"))
+	before, _ := time.Parse(time.RFC3339, q.Get("before"))
+	page, _ := strconv.Atoi(q.Get("page"))
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if s.failPages[page] {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	matching := []cloudflare.AuditLog{}
+	for _, al := range s.entries {
+		when, _ := time.Parse(time.RFC3339, al.When)
+		if !when.Before(since) && when.Before(before) {
+			matching = append(matching, al)
+		}
+	}
+	start, end := (page-1)*perPage, page*perPage
+	if start > len(matching) {
+		start = len(matching)
+	}
+	if end > len(matching) {
+		end = len(matching)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": matching[start:end]})
+}
+
+func (s *testAuditLogs) add(id string, when string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = append(s.entries, cloudflare.AuditLog{ID: id, When: when})
+}
+
+func publishedAuditIDs(events []common.MapStr) []string {
+	ids := []string{}
+	for _, evt := range events {
+		id, _ := evt.GetValue("audit.id")
+		ids = append(ids, id.(string))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestCollectAuditLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs := &testAuditLogs{failPages: map[int]bool{2: true}}
+	logs.add("e1", "2017-07-14T02:40:00Z")
+	logs.add("e2", "2017-07-14T02:41:00Z")
+	logs.add("e3", "2017-07-14T02:41:00Z")
+	logs.add("e4", "2017-07-14T02:42:00Z")
+	logs.add("e5", "2017-07-14T02:43:00Z")
+	server := httptest.NewServer(logs)
+	defer server.Close()
+
+	cfg := config.DefaultConfig
+	cfg.AuditLogsAccountID = "acct"
+	cfg.AuditLogsPeriod = 5 * time.Minute
+	cfg.AuditLogsPageSize = 2
+	bt, client := newTestBeat(t, dir, cfg, server.URL)
+
+	// The checkpoint moves after the first page, and stays there when the second one fails
+	bt.CollectAuditLogs(time.Date(2017, 7, 14, 2, 42, 30, 0, time.UTC))
+	if ids := publishedAuditIDs(client.events); !reflect.DeepEqual(ids, []string{"e1", "e2"}) {
+		t.Errorf("The published entries are %v, expected e1 and e2", ids)
+	}
+	if when, ids := bt.state.GetAuditLogsCheckpoint(); when != "2017-07-14T02:41:00Z" || !reflect.DeepEqual(ids, []string{"e2"}) {
+		t.Errorf("Unexpected checkpoint %s %v", when, ids)
+	}
+
+	// The next run starts from the checkpoint, dropping the entries which were already published at its time
+	logs.failPages = nil
+	bt.CollectAuditLogs(time.Date(2017, 7, 14, 2, 44, 0, 0, time.UTC))
+	if ids := publishedAuditIDs(client.events); !reflect.DeepEqual(ids, []string{"e1", "e2", "e3", "e4", "e5"}) {
+		t.Errorf("The published entries are %v, expected each of them once", ids)
+	}
+	if when, ids := bt.state.GetAuditLogsCheckpoint(); when != "2017-07-14T02:43:00Z" || !reflect.DeepEqual(ids, []string{"e5"}) {
+		t.Errorf("Unexpected checkpoint %s %v", when, ids)
+	}
+
+	// The checkpoint doesn't move when the entries can't be published
+	logs.add("e6", "2017-07-14T02:45:00Z")
+	client.fail = true
+	bt.CollectAuditLogs(time.Date(2017, 7, 14, 2, 46, 0, 0, time.UTC))
+	if when, ids := bt.state.GetAuditLogsCheckpoint(); when != "2017-07-14T02:43:00Z" || !reflect.DeepEqual(ids, []string{"e5"}) {
+		t.Errorf("The checkpoint moved to %s %v while the entries couldn't be published", when, ids)
+	}
+}
@@ -2,12 +2,15 @@ package beater
 
 import (
 	"fmt"
-	//"sync"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/libbeat/beat"
 	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
 	"github.com/elastic/beats/libbeat/publisher"
 	"github.com/hartfordfive/cloudflarebeat/cloudflare"
 	"github.com/hartfordfive/cloudflarebeat/config"
@@ -25,6 +28,10 @@ type Cloudflarebeat struct {
 	client      publisher.Client
 	state       *cloudflare.StateFile
 	logConsumer *cloudflare.LogConsumer
+	logpush     logpushObjects
+	apiClient   *cloudflare.CloudflareClient
+
+	logpushAttempts map[string]int
 }
 
 var timeStart, timeEnd, timeNow int
@@ -36,6 +43,48 @@ func New(b *beat.Beat, cfg *common.Config) (beat.Beater, error) {
 		return nil, fmt.Errorf("Error reading config file: %v", err)
 	}
 
+	if config.InputType != "api" && config.InputType != "file" && config.InputType != "s3" && config.InputType != "http" && config.InputType != "none" {
+		return nil, fmt.Errorf("Unsupported input type '%s'", config.InputType)
+	}
+	if config.InputType == "none" && !config.FirewallEventsEnabled && !config.AuditLogsEnabled && !config.GraphQLEnabled {
+		return nil, fmt.Errorf("Must enable the firewall events, audit logs or GraphQL collectors when using the none input type")
+	}
+	if config.InputType == "file" && len(config.FileInputPaths) == 0 {
+		return nil, fmt.Errorf("Must specify file_input_paths when using the file input type")
+	}
+	if config.InputType == "s3" && config.LogpushS3AfterProcessing != "none" && config.LogpushS3AfterProcessing != "delete" && config.LogpushS3AfterProcessing != "tag" {
+		return nil, fmt.Errorf("Unsupported logpush_s3_after_processing action '%s'", config.LogpushS3AfterProcessing)
+	}
+	if config.InputType == "http" && config.HTTPInputSecret == "" && (config.HTTPInputUsername == "" || config.HTTPInputPassword == "") {
+		return nil, fmt.Errorf("Must specify http_input_secret or http_input_username and http_input_password when using the http input type")
+	}
+	if config.AuditLogsEnabled && (config.AuditLogsPageSize < 1 || config.AuditLogsPageSize > 1000) {
+		return nil, fmt.Errorf("audit_logs_page_size must be between 1 and 1000")
+	}
+	if config.GraphQLEnabled {
+		if len(config.GraphQLQueries) == 0 {
+			return nil, fmt.Errorf("Must specify graphql_queries when graphql_enabled is set")
+		}
+		names := map[string]bool{}
+		for _, q := range config.GraphQLQueries {
+			if q.Name == "" || q.Query == "" || names[q.Name] {
+				return nil, fmt.Errorf("Each of the graphql_queries must have a unique name and a query")
+			}
+			names[q.Name] = true
+		}
+		if len(config.GraphQLZoneTags) == 0 {
+			config.GraphQLZoneTags = []string{config.ZoneTag}
+		}
+	}
+
+	if config.RetryMaxAttempts < 1 || config.RetrySegmentsPerPeriod < 1 {
+		return nil, fmt.Errorf("retry_max_attempts and retry_segments_per_period must be at least 1")
+	}
+
+	if config.SampleRate <= 0 || config.SampleRate > 1 || config.ClientSampleRate <= 0 || config.ClientSampleRate > 1 {
+		return nil, fmt.Errorf("sample_rate and client_sample_rate must be greater than 0 and at most 1")
+	}
+
 	if config.Period.Minutes() < 1 || config.Period.Minutes() > 30 {
 		logp.Warn("Chosen period of %s is not valid. Changing to 5m", config.Period.String())
 		config.Period = 5 * time.Minute
@@ -47,6 +96,123 @@ func New(b *beat.Beat, cfg *common.Config) (beat.Beater, error) {
 		logConsumer: cloudflare.NewLogConsumer(config.Email, config.APIKey, TOTAL_LOGFILE_SEGMENTS, config.ProcessedEventsBufferSize, 6),
 	}
 
+	if len(config.LogFields) > 0 {
+		fields, err := cloudflare.CheckLogFields(config.LogFields)
+		if err != nil {
+			return nil, err
+		}
+		config.LogFields = fields
+		if err := validateFields(config); err != nil {
+			return nil, err
+		}
+		bt.logConsumer.Fields = config.LogFields
+	}
+
+	if err := ConfigureEventStages(bt.logConsumer, config); err != nil {
+		return nil, err
+	}
+
+	// The logs are only sampled by the API with the api input type
+	if config.InputType == "api" {
+		bt.logConsumer.SampleRate = config.SampleRate
+	}
+	if config.ClientSampleRate < 1 {
+		bt.logConsumer.Sampler = cloudflare.NewRayIDSampler(config.ClientSampleRate)
+	}
+
+	if config.DedupByRayID {
+		bt.logConsumer.RayIDCache = cloudflare.NewRayIDCache(config.DedupWindow)
+	}
+
+	if config.DeadLetterPath != "" {
+		dlf, err := cloudflare.NewDeadLetterFile(config.DeadLetterPath, "cloudflarebeat-dead-letter-"+config.ZoneTag+".ndjson", config.DeadLetterRotateEveryKb, config.DeadLetterNumberOfFiles)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating the dead-letter file: %v", err)
+		}
+		bt.logConsumer.DeadLetterFile = dlf
+	}
+
+	sf, err := NewStateFile(config)
+	if err != nil {
+		logp.Err("Statefile error: %v", err)
+		return nil, err
+	}
+
+	bt.state = sf
+
+	if config.InputType == "s3" {
+		lp, err := cloudflare.NewLogpushBucket(map[string]string{
+			"bucket_name":           config.LogpushS3BucketName,
+			"region":                config.LogpushS3Region,
+			"endpoint":              config.LogpushS3Endpoint,
+			"aws_access_key":        config.AwsAccessKey,
+			"aws_secret_access_key": config.AwsSecretAccessKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		bt.logpush = lp
+		bt.logpushAttempts = map[string]int{}
+	}
+
+	if config.FirewallEventsEnabled || config.AuditLogsEnabled || config.GraphQLEnabled {
+		bt.apiClient = cloudflare.NewClient(map[string]interface{}{
+			"api_key": config.APIKey,
+			"email":   config.Email,
+			"debug":   config.Debug,
+		})
+	}
+
+	if gaps := bt.state.GetGaps(); len(gaps) > 0 {
+		logp.Warn("The logs for %d time range(s) could not be retrieved within the retention period: %v", len(gaps), gaps)
+	}
+
+	return bt, nil
+}
+
+// validateFields checks that the configured log fields are available for the zone, and warns about the ones which
+// aren't mapped in the fields.yml file
+func validateFields(config config.Config) error {
+
+	client := cloudflare.NewClient(map[string]interface{}{
+		"api_key": config.APIKey,
+		"email":   config.Email,
+		"debug":   config.Debug,
+	})
+	available, err := client.GetLogFields(config.ZoneTag)
+	if err != nil {
+		logp.Warn("Could not get the available log fields to validate the configured fields: %v", err)
+		return nil
+	}
+
+	mapped, err := cloudflare.LoadFieldsYml(paths.Resolve(paths.Config, "fields.yml"))
+	if err != nil {
+		logp.Debug("fields", "Not checking the configured fields against fields.yml: %v", err)
+	}
+
+	report := cloudflare.CheckFields(config.LogFields, available, mapped)
+	if len(report.Unmapped) > 0 {
+		logp.Warn("The configured fields %v are not mapped in fields.yml", report.Unmapped)
+	}
+	if len(report.Unknown) > 0 {
+		return fmt.Errorf("The configured fields %v are not available for zone %s", report.Unknown, config.ZoneTag)
+	}
+
+	return nil
+}
+
+// NewStateFile loads the state file of the configured zone from the configured storage type
+func NewStateFile(config config.Config) (*cloudflare.StateFile, error) {
+	return cloudflare.NewStateFile(stateFileConfig(config))
+}
+
+// OpenStateFile loads the existing state file of the configured zone read-only, without creating it if it's missing
+func OpenStateFile(config config.Config) (*cloudflare.StateFile, error) {
+	return cloudflare.OpenStateFile(stateFileConfig(config))
+}
+
+func stateFileConfig(config config.Config) map[string]string {
+
 	sfConf := map[string]string{
 		"filename":     config.StateFileName,
 		"filepath":     config.StateFilePath,
@@ -60,15 +226,7 @@ func New(b *beat.Beat, cfg *common.Config) (beat.Beater, error) {
 		sfConf["aws_s3_bucket_name"] = config.AwsS3BucketName
 	}
 
-	sf, err := cloudflare.NewStateFile(sfConf)
-	if err != nil {
-		logp.Err("Statefile error: %v", err)
-		return nil, err
-	}
-
-	bt.state = sf
-
-	return bt, nil
+	return sfConf
 }
 
 func (bt *Cloudflarebeat) Run(b *beat.Beat) error {
@@ -76,6 +234,28 @@ func (bt *Cloudflarebeat) Run(b *beat.Beat) error {
 	logp.Info("cloudflarebeat is running! Hit CTRL-C to stop it.")
 	bt.client = b.Publisher.Connect()
 
+	if bt.config.FirewallEventsEnabled {
+		go bt.runFirewallCollector()
+	}
+	if bt.config.AuditLogsEnabled {
+		go bt.runAuditLogCollector()
+	}
+	if bt.config.GraphQLEnabled {
+		go bt.runGraphQLCollector()
+	}
+
+	if bt.config.InputType == "file" {
+		return bt.runFileInput()
+	} else if bt.config.InputType == "s3" {
+		return bt.runLogpushInput()
+	} else if bt.config.InputType == "http" {
+		return bt.runHTTPInput()
+	} else if bt.config.InputType == "none" {
+		// Only the collectors run, without polling the ELS API
+		<-bt.done
+		return nil
+	}
+
 	/*
 		If a state file already exists and is loaded, download and process the cloudflare logs
 		immediately from now to the last end timestamp
@@ -135,8 +315,19 @@ func (bt *Cloudflarebeat) DownloadAndPublish(timeNow int, timeStart int, timeEnd
 
 	bt.state.UpdateLastRequestTS(timeNow)
 
-	// Download the log segement files seperately/in-parallel in a seperate goroutine
-	go bt.logConsumer.DownloadCurrentLogFiles(bt.config.ZoneTag, timeStart, timeEnd)
+	// Along with the current time period, retry some of the previously failed segments that are still within the
+	// retention period
+	segments := cloudflare.SplitTimeRange(timeStart, timeEnd, TOTAL_LOGFILE_SEGMENTS)
+	// The Logpull API rejects the time ranges longer than an hour, such as long catch-ups
+	segments = cloudflare.SplitLongTimeRanges(segments, cloudflare.MAX_SEGMENT_SECONDS)
+	retries := bt.state.GetRetryRanges(timeNow, bt.config.RetrySegmentsPerPeriod)
+	if len(retries) > 0 {
+		logp.Info("Retrying %d previously failed log segment(s)", len(retries))
+		segments = append(segments, retries...)
+	}
+
+	// Download the log segement files seperately/in-parallel in seperate goroutines
+	bt.logConsumer.DownloadLogSegments(bt.config.ZoneTag, segments)
 
 	// As log files become ready, process it it and generate the events in a seperate goroutine
 	go bt.logConsumer.PrepareEvents()
@@ -144,15 +335,17 @@ func (bt *Cloudflarebeat) DownloadAndPublish(timeNow int, timeStart int, timeEnd
 	// Finally, publish all the events as they're placed on the channel, then update the state file once completed
 	go func(bt *Cloudflarebeat) {
 		logp.Info("Creating worker to publish events")
-		for {
-			select {
-			case <-bt.logConsumer.CompletedNotifier:
-				logp.Info("Completed processing all events for this time period")
-				break
-			case evt := <-bt.logConsumer.EventsReady:
-				bt.client.PublishEvent(evt)
-			}
+		bt.publishUntilCompleted(nil)
+
+		completed, failed := bt.logConsumer.SegmentResults()
+		for _, r := range completed {
+			bt.state.MarkRangeCompleted(r)
+		}
+		for _, r := range failed {
+			logp.Warn("Log segment from %s failed and will be retried", r)
+			bt.state.MarkRangeFailed(r, bt.config.RetryMaxAttempts)
 		}
+
 		bt.state.UpdateLastStartTS(timeStart)
 		bt.state.UpdateLastEndTS(timeEnd)
 		bt.state.UpdateLastRequestTS(timeNow)
@@ -167,6 +360,149 @@ func (bt *Cloudflarebeat) DownloadAndPublish(timeNow int, timeStart int, timeEnd
 
 }
 
+// publishUntilCompleted publishes the events as they're prepared by the log consumer, until all of the queued log
+// files have been processed. When acked is set, the events are published with guaranteed delivery and acked is
+// done once all of them have been acknowledged by the output.
+func (bt *Cloudflarebeat) publishUntilCompleted(acked *sync.WaitGroup) {
+
+	publish := func(evt common.MapStr) {
+		if acked == nil {
+			bt.client.PublishEvent(evt)
+			return
+		}
+		acked.Add(1)
+		bt.client.PublishEvent(evt, publisher.Guaranteed, publisher.Signal(op.SignalCallback(func(op.SignalResponse) {
+			acked.Done()
+		})))
+	}
+
+	for {
+		select {
+		case <-bt.logConsumer.CompletedNotifier:
+			logp.Info("Completed processing all events for this time period")
+			// Publish the events which are still buffered
+			for {
+				select {
+				case evt := <-bt.logConsumer.EventsReady:
+					publish(evt)
+				default:
+					return
+				}
+			}
+		case evt := <-bt.logConsumer.EventsReady:
+			publish(evt)
+		}
+	}
+}
+
+// runFileInput processes the local log files matching the configured paths, then keeps scanning for new files
+// if file_input_watch is enabled
+func (bt *Cloudflarebeat) runFileInput() error {
+
+	logp.Info("Processing local log files matching %v", bt.config.FileInputPaths)
+	ticker := time.NewTicker(bt.config.FileInputScanFrequency)
+	defer ticker.Stop()
+
+	for {
+		files, infos, err := bt.newLocalFiles()
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			bt.ProcessAndPublishFiles(files, infos)
+		}
+
+		if !bt.config.FileInputWatch {
+			logp.Info("Done processing the local log files")
+			return nil
+		}
+
+		select {
+		case <-bt.done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// newLocalFiles returns the local files matching the configured paths which haven't been processed yet
+func (bt *Cloudflarebeat) newLocalFiles() ([]string, map[string]os.FileInfo, error) {
+
+	files, err := cloudflare.ListLocalFiles(bt.config.FileInputPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newFiles := []string{}
+	infos := map[string]os.FileInfo{}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil || bt.state.IsFileProcessed(f, info.Size(), info.ModTime().Unix()) {
+			continue
+		}
+		// Files which were just modified may still be written to, so leave them for the next scan
+		if bt.config.FileInputWatch && time.Since(info.ModTime()) < bt.config.FileInputScanFrequency {
+			continue
+		}
+		newFiles = append(newFiles, f)
+		infos[f] = info
+	}
+
+	return newFiles, infos, nil
+}
+
+// ProcessAndPublishFiles processes the given local log files and publishes their events, then records the files
+// as processed in the state file once all of their events are acknowledged
+func (bt *Cloudflarebeat) ProcessAndPublishFiles(files []string, infos map[string]os.FileInfo) {
+
+	logp.Info("Processing %d local log file(s)", len(files))
+
+	completed, failed, ok := bt.publishLocalFiles(files)
+	if !ok {
+		return
+	}
+
+	for _, f := range completed {
+		bt.state.MarkFileProcessed(f, infos[f].Size(), infos[f].ModTime().Unix())
+	}
+	for _, f := range failed {
+		logp.Err("Could not process local log file %s, it will be retried on the next scan", f)
+	}
+
+	if err := bt.state.Save(); err != nil {
+		logp.Info("[ERROR] Could not persist state file to storage: %s", err.Error())
+	} else {
+		logp.Info("Updated state file")
+	}
+}
+
+// publishLocalFiles processes the given local log files and publishes their events, then waits for all of the
+// events to be acknowledged. The files which were completely processed and the ones which failed are returned,
+// unless the beat was stopped before all the events were acknowledged.
+func (bt *Cloudflarebeat) publishLocalFiles(files []string) ([]string, []string, bool) {
+
+	bt.logConsumer.QueueLocalFiles(files)
+	go bt.logConsumer.PrepareEvents()
+
+	acked := &sync.WaitGroup{}
+	bt.publishUntilCompleted(acked)
+
+	ackedAll := make(chan struct{})
+	go func() {
+		acked.Wait()
+		close(ackedAll)
+	}()
+	select {
+	case <-ackedAll:
+	case <-bt.done:
+		logp.Info("Stopped before all the events from the log files were acknowledged")
+		return nil, nil, false
+	}
+
+	completed, failed := bt.logConsumer.FileResults()
+	return completed, failed, true
+}
+
 func (bt *Cloudflarebeat) Stop() {
 	if err := bt.state.Save(); err != nil {
 		logp.Info("[ERROR] Could not persist state file to storage while shutting down: %s", err.Error())
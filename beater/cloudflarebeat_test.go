@@ -0,0 +1,71 @@
+//go:build !integration
+// +build !integration
+
+package beater
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+func TestNewLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-file-input-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(logs, "a.ndjson"), filepath.Join(logs, "b.ndjson")
+	old := time.Now().Add(-time.Hour)
+	for _, f := range []string{a, b} {
+		if err := ioutil.WriteFile(f, []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.DefaultConfig
+	cfg.FileInputPaths = []string{logs}
+	cfg.FileInputScanFrequency = time.Minute
+	bt, _ := newTestBeat(t, dir, cfg, "")
+
+	files, infos, err := bt.newLocalFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{a, b}) || len(infos) != 2 {
+		t.Fatalf("The new files are %v, expected %s and %s", files, a, b)
+	}
+
+	// The processed files are skipped until they change
+	for _, f := range files {
+		bt.state.MarkFileProcessed(f, infos[f].Size(), infos[f].ModTime().Unix())
+	}
+	if files, _, _ := bt.newLocalFiles(); len(files) != 0 {
+		t.Errorf("Expected the processed files to be skipped, got %v", files)
+	}
+	if err := ioutil.WriteFile(a, []byte("{}\n{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if files, _, _ := bt.newLocalFiles(); !reflect.DeepEqual(files, []string{a}) {
+		t.Errorf("Expected the modified file %s to be processed again, got %v", a, files)
+	}
+
+	// When watching the paths, the files which were just modified are left for the next scan
+	bt.config.FileInputWatch = true
+	if files, _, _ := bt.newLocalFiles(); len(files) != 0 {
+		t.Errorf("Expected the file being written to be skipped, got %v", files)
+	}
+}
@@ -0,0 +1,107 @@
+package beater
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/paths"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+// ConfigureEventStages sets up the enrichment, privacy and output schema stages through which the log consumer runs
+// the events of the request logs
+func ConfigureEventStages(lc *cloudflare.LogConsumer, config config.Config) error {
+	if config.OutputSchema != "cloudflare" && config.OutputSchema != "ecs" {
+		return fmt.Errorf("Unsupported output schema '%s'", config.OutputSchema)
+	}
+	lc.OutputSchema = config.OutputSchema
+
+	if config.GeoIPCityDatabase != "" || config.GeoIPASNDatabase != "" {
+		cityDatabase, asnDatabase := config.GeoIPCityDatabase, config.GeoIPASNDatabase
+		if cityDatabase != "" {
+			cityDatabase = paths.Resolve(paths.Config, cityDatabase)
+		}
+		if asnDatabase != "" {
+			asnDatabase = paths.Resolve(paths.Config, asnDatabase)
+		}
+		geoip, err := cloudflare.NewGeoIPEnricher(cityDatabase, asnDatabase)
+		if err != nil {
+			return fmt.Errorf("Error opening the GeoIP databases: %v", err)
+		}
+		lc.GeoIP = geoip
+	}
+
+	privacy, err := cloudflare.NewPrivacyFilter(map[string]interface{}{
+		"client_ip":          config.PrivacyClientIP,
+		"ipv4_prefix_length": config.PrivacyIPv4PrefixLength,
+		"ipv6_prefix_length": config.PrivacyIPv6PrefixLength,
+		"cookies":            config.PrivacyCookies,
+		"headers":            config.PrivacyHeaders,
+		"headers_mode":       config.PrivacyHeadersMode,
+		"query_params":       config.PrivacyQueryParams,
+		"hash_key":           config.PrivacyHashKey,
+	})
+	if err != nil {
+		return fmt.Errorf("Invalid privacy settings: %v", err)
+	}
+	if privacy.Enabled() {
+		lc.Privacy = privacy
+	}
+
+	include, exclude := map[string][]string{}, map[string][]string{}
+	for _, rule := range config.HeaderRules {
+		// Without an include list, all the headers of the object which aren't excluded are kept
+		if len(rule.Include) > 0 {
+			include[rule.Object] = append(include[rule.Object], rule.Include...)
+		}
+		if len(rule.Exclude) > 0 {
+			exclude[rule.Object] = append(exclude[rule.Object], rule.Exclude...)
+		}
+	}
+	headers, err := cloudflare.NewHeaderFilter(map[string]interface{}{
+		"include": include,
+		"exclude": exclude,
+		"other":   config.HeadersOther,
+	})
+	if err != nil {
+		return fmt.Errorf("Invalid header rules: %v", err)
+	}
+	if headers.Enabled() {
+		lc.HeaderFilter = headers
+	}
+
+	if config.UserAgentParsingEnabled {
+		regexesFile := config.UserAgentRegexesFile
+		if regexesFile != "" {
+			regexesFile = paths.Resolve(paths.Config, regexesFile)
+		}
+		uap, err := cloudflare.NewUserAgentParser(regexesFile, config.UserAgentCacheSize)
+		if err != nil {
+			return fmt.Errorf("Error loading the user agent regexes: %v", err)
+		}
+		lc.UserAgentParser = uap
+	}
+
+	if config.URIParsingEnabled {
+		lc.URIParser = cloudflare.NewURIParser(config.URIQueryParams)
+	}
+
+	for i, rule := range config.FieldRules {
+		renames := [][2]string{}
+		for _, rename := range rule.Rename {
+			renames = append(renames, [2]string{rename.From, rename.To})
+		}
+		fieldRule, err := cloudflare.NewFieldRule(map[string]interface{}{
+			"zones":   rule.Zones,
+			"include": rule.Include,
+			"exclude": rule.Exclude,
+			"rename":  renames,
+		})
+		if err != nil {
+			return fmt.Errorf("Invalid field rule %d: %v", i+1, err)
+		}
+		lc.FieldRules = append(lc.FieldRules, fieldRule)
+	}
+
+	return nil
+}
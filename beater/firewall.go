@@ -0,0 +1,88 @@
+package beater
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/publisher"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+)
+
+// runFirewallCollector collects the firewall events every firewall_events_period, alongside the configured input
+func (bt *Cloudflarebeat) runFirewallCollector() {
+
+	logp.Info("Collecting the firewall events every %s", bt.config.FirewallEventsPeriod)
+	ticker := time.NewTicker(bt.config.FirewallEventsPeriod)
+	defer ticker.Stop()
+
+	for {
+		bt.CollectFirewallEvents(int(time.Now().UTC().Unix()))
+
+		select {
+		case <-bt.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectFirewallEvents publishes the firewall events which occurred since the last collection, page by page, and then
+// moves the firewall events checkpoint of the state file. If any page fails, the checkpoint is left as is so that the
+// whole time range is collected again on the next run.
+func (bt *Cloudflarebeat) CollectFirewallEvents(timeNow int) {
+
+	// Events can take a moment to become available from the API, so they're only collected up to the configured delay
+	timeEnd := timeNow - int(bt.config.FirewallEventsDelay.Seconds())
+	timeStart := bt.state.GetFirewallEventsLastTS() + 1
+	if timeStart == 1 {
+		timeStart = timeEnd - int(bt.config.FirewallEventsPeriod.Seconds()) + 1
+	}
+	if timeStart > timeEnd {
+		return
+	}
+
+	r := cloudflare.TimeRange{Start: timeStart, End: timeEnd}
+	logp.Info("Collecting the firewall events from %s", r)
+
+	total := 0
+	cursor := ""
+	for {
+		page, next, err := bt.apiClient.GetFirewallEvents(bt.config.ZoneTag, r, cursor, bt.config.FirewallEventsPageSize)
+		if err != nil {
+			logp.Err("Could not get the firewall events from %s, they will be retried: %v", r, err)
+			return
+		}
+
+		events := []common.MapStr{}
+		for _, fe := range page {
+			evt, err := cloudflare.BuildFirewallMapStr(fe)
+			if err != nil {
+				logp.Warn("Skipping firewall event %s: %v", fe.RayID, err)
+				continue
+			}
+			if bt.logConsumer.Privacy != nil {
+				bt.logConsumer.Privacy.Apply(evt)
+			}
+			events = append(events, evt)
+		}
+
+		if len(events) > 0 && !bt.client.PublishEvents(events, publisher.Sync) {
+			logp.Err("Could not publish the firewall events from %s, they will be retried", r)
+			return
+		}
+		total += len(events)
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	logp.Info("Published %d firewall events from %s", total, r)
+
+	bt.state.UpdateFirewallEventsLastTS(timeEnd)
+	if err := bt.state.Save(); err != nil {
+		logp.Info("[ERROR] Could not persist state file to storage: %s", err.Error())
+	}
+}
@@ -0,0 +1,94 @@
+//go:build !integration
+// +build !integration
+
+package beater
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+func TestCollectFirewallEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-firewall-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Three pages of two events, the second page failing while failPage2 is set
+	var lock sync.Mutex
+	requests := []string{}
+	failPage2 := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		lock.Lock()
+		requests = append(requests, q.Get("since")+" "+q.Get("until")+" "+q.Get("cursor"))
+		fail := failPage2 && q.Get("cursor") == "page2"
+		lock.Unlock()
+
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next := map[string]string{"": "page2", "page2": "page3", "page3": "page4"}[q.Get("cursor")]
+		events := `{"ray_id": "a", "occurred_at": "2017-07-14T02:40:00Z"}, {"ray_id": "b", "occurred_at": "2017-07-14T02:41:00Z"}`
+		if q.Get("cursor") == "page3" {
+			events = `{"ray_id": "c", "occurred_at": "2017-07-14T02:42:00Z"}`
+		}
+		fmt.Fprintf(w, `{"success": true, "result": [%s], "result_info": {"cursors": {"after": "%s"}}}`, events, next)
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig
+	cfg.ZoneTag = "zone"
+	cfg.FirewallEventsPeriod = 5 * time.Minute
+	cfg.FirewallEventsDelay = 1 * time.Minute
+	cfg.FirewallEventsPageSize = 2
+	bt, client := newTestBeat(t, dir, cfg, server.URL)
+
+	// The events are collected from the checkpoint up to the delay
+	now := int(time.Date(2017, 7, 14, 2, 46, 0, 0, time.UTC).Unix())
+	checkpoint := int(time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC).Unix())
+	bt.state.UpdateFirewallEventsLastTS(checkpoint)
+	bt.CollectFirewallEvents(now)
+	if expected := []string{"2017-07-14T02:40:01Z 2017-07-14T02:45:01Z ", "2017-07-14T02:40:01Z 2017-07-14T02:45:01Z page2"}; !reflect.DeepEqual(requests, expected) {
+		t.Errorf("The requests are %v, expected %v", requests, expected)
+	}
+	if ts := bt.state.GetFirewallEventsLastTS(); ts != checkpoint {
+		t.Errorf("The checkpoint moved to %d while a page failed", ts)
+	}
+
+	// The whole time range is collected again, up to the new end
+	requests, failPage2 = nil, false
+	client.events = nil
+	bt.CollectFirewallEvents(now + 60)
+	if expected := []string{"2017-07-14T02:40:01Z 2017-07-14T02:46:01Z ", "2017-07-14T02:40:01Z 2017-07-14T02:46:01Z page2", "2017-07-14T02:40:01Z 2017-07-14T02:46:01Z page3"}; !reflect.DeepEqual(requests, expected) {
+		t.Errorf("The requests are %v, expected %v", requests, expected)
+	}
+	if len(client.events) != 5 {
+		t.Errorf("%d events were published, expected 5", len(client.events))
+	}
+	if ts := bt.state.GetFirewallEventsLastTS(); ts != now {
+		t.Errorf("The checkpoint is %d, expected %d", ts, now)
+	}
+
+	// The next collection starts right after the checkpoint, and doesn't move it if the events can't be published
+	requests = nil
+	client.fail = true
+	bt.CollectFirewallEvents(now + 360)
+	if len(requests) != 1 || requests[0] != "2017-07-14T02:46:01Z 2017-07-14T02:51:01Z " {
+		t.Errorf("The requests are %v, expected to start after the checkpoint", requests)
+	}
+	if ts := bt.state.GetFirewallEventsLastTS(); ts != now {
+		t.Errorf("The checkpoint moved to %d while the events couldn't be published", ts)
+	}
+}
@@ -0,0 +1,102 @@
+package beater
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/publisher"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+// runGraphQLCollector runs the GraphQL queries for each zone every graphql_period, alongside the configured input
+func (bt *Cloudflarebeat) runGraphQLCollector() {
+
+	logp.Info("Running %d GraphQL queries for %d zone(s) every %s", len(bt.config.GraphQLQueries), len(bt.config.GraphQLZoneTags), bt.config.GraphQLPeriod)
+	ticker := time.NewTicker(bt.config.GraphQLPeriod)
+	defer ticker.Stop()
+
+	for {
+		bt.CollectGraphQLMetrics(time.Now().UTC())
+
+		select {
+		case <-bt.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectGraphQLMetrics runs each of the GraphQL queries for each zone, from its last checkpoint up to the configured
+// delay, and then saves the state file
+func (bt *Cloudflarebeat) CollectGraphQLMetrics(timeNow time.Time) {
+
+	// The analytics are only complete after a delay, and the windows are aligned on minutes to match the datasets
+	until := timeNow.Add(-bt.config.GraphQLDelay).Truncate(time.Minute)
+
+	collected := false
+	for _, zoneTag := range bt.config.GraphQLZoneTags {
+		for _, q := range bt.config.GraphQLQueries {
+			if bt.collectGraphQLQuery(zoneTag, q, until) {
+				collected = true
+			}
+		}
+	}
+
+	if collected {
+		if err := bt.state.Save(); err != nil {
+			logp.Info("[ERROR] Could not persist state file to storage: %s", err.Error())
+		}
+	}
+}
+
+// collectGraphQLQuery publishes the rows of the query for the zone, one window of at most graphql_max_window at a time,
+// and moves the checkpoint of the query and zone after each window. Returns true if the checkpoint was moved.
+func (bt *Cloudflarebeat) collectGraphQLQuery(zoneTag string, q config.GraphQLQuery, until time.Time) bool {
+
+	key := zoneTag + "/" + q.Name
+	since := until.Add(-bt.config.GraphQLPeriod)
+	if ts := bt.state.GetGraphQLCheckpoint(key); ts != 0 {
+		since = time.Unix(int64(ts), 0).UTC()
+	}
+	// Older data is no longer available from the datasets, so it's skipped
+	if oldest := until.Add(-bt.config.GraphQLMaxLookback); since.Before(oldest) {
+		logp.Warn("Skipping the GraphQL query %s for zone %s from %s to %s, which is older than the graphql_max_lookback", q.Name, zoneTag, since, oldest)
+		since = oldest
+	}
+
+	moved := false
+	for since.Before(until) {
+		windowEnd := since.Add(bt.config.GraphQLMaxWindow)
+		if windowEnd.After(until) {
+			windowEnd = until
+		}
+
+		rows, err := bt.apiClient.QueryGraphQL(q.Query, zoneTag, since, windowEnd, bt.config.GraphQLLimit)
+		if err != nil {
+			logp.Err("GraphQL query %s for zone %s from %s failed, it will be retried: %v", q.Name, zoneTag, since, err)
+			return moved
+		}
+		if len(rows) >= bt.config.GraphQLLimit {
+			logp.Warn("GraphQL query %s for zone %s from %s returned %d rows, which may have been truncated by the graphql_limit", q.Name, zoneTag, since, len(rows))
+		}
+
+		events := []common.MapStr{}
+		for _, row := range rows {
+			events = append(events, cloudflare.BuildGraphQLMapStr(q.Name, zoneTag, since, windowEnd, row))
+		}
+		if len(events) > 0 && !bt.client.PublishEvents(events, publisher.Sync) {
+			logp.Err("Could not publish the rows of GraphQL query %s for zone %s from %s, they will be retried", q.Name, zoneTag, since)
+			return moved
+		}
+
+		logp.Debug("graphql", "Published %d rows of GraphQL query %s for zone %s from %s to %s", len(events), q.Name, zoneTag, since, windowEnd)
+
+		bt.state.UpdateGraphQLCheckpoint(key, int(windowEnd.Unix()))
+		moved = true
+		since = windowEnd
+	}
+
+	return moved
+}
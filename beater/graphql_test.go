@@ -0,0 +1,146 @@
+//go:build !integration
+// +build !integration
+
+package beater
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/publisher"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+// memoryPublisher keeps the published events in memory, or fails to publish them when fail is set
+type memoryPublisher struct {
+	lock   sync.Mutex
+	events []common.MapStr
+	fail   bool
+}
+
+func (p *memoryPublisher) Close() error {
+	return nil
+}
+
+func (p *memoryPublisher) PublishEvent(event common.MapStr, opts ...publisher.ClientOption) bool {
+	return p.PublishEvents([]common.MapStr{event}, opts...)
+}
+
+func (p *memoryPublisher) PublishEvents(events []common.MapStr, opts ...publisher.ClientOption) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.fail {
+		return false
+	}
+	p.events = append(p.events, events...)
+	return true
+}
+
+// newTestBeat returns a beat publishing to memory, with a state file in the given directory and an API client for
+// the given server
+func newTestBeat(t *testing.T, dir string, cfg config.Config, serverURL string) (*Cloudflarebeat, *memoryPublisher) {
+	sf, err := cloudflare.NewStateFile(map[string]string{
+		"filename":     "cloudflarebeat",
+		"filepath":     dir,
+		"zone_tag":     "zone",
+		"storage_type": "disk",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &memoryPublisher{}
+	return &Cloudflarebeat{
+		config:      cfg,
+		state:       sf,
+		client:      client,
+		logConsumer: cloudflare.NewLogConsumer("", "", 1, 1, 1),
+		apiClient: cloudflare.NewClient(map[string]interface{}{
+			"api_key":  "key",
+			"email":    "user@example.com",
+			"api_base": serverURL,
+		}),
+	}, client
+}
+
+func TestCollectGraphQLMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-graphql-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each window returns a single row, and the windows starting at failSince fail
+	var lock sync.Mutex
+	windows := []string{}
+	failSince := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		since, _ := req.Variables["since"].(string)
+
+		lock.Lock()
+		windows = append(windows, since+" "+req.Variables["until"].(string))
+		fail := since == failSince
+		lock.Unlock()
+
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"data": {"viewer": {"zones": [{"httpRequests1mGroups": [{"dimensions": {"datetimeMinute": "` + since + `"}, "count": 1}]}]}}}`))
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig
+	cfg.GraphQLZoneTags = []string{"zone"}
+	cfg.GraphQLQueries = []config.GraphQLQuery{{Name: "requests", Query: "query"}}
+	cfg.GraphQLDelay = 0
+	cfg.GraphQLMaxWindow = 5 * time.Minute
+	bt, client := newTestBeat(t, dir, cfg, server.URL)
+
+	// Catch up on 15 minutes, with the second window failing
+	now := time.Date(2017, 7, 14, 3, 0, 30, 0, time.UTC)
+	bt.state.UpdateGraphQLCheckpoint("zone/requests", int(time.Date(2017, 7, 14, 2, 30, 0, 0, time.UTC).Unix()))
+	failSince = "2017-07-14T02:40:00Z"
+	bt.CollectGraphQLMetrics(now.Add(-15 * time.Minute))
+
+	if expected := []string{"2017-07-14T02:30:00Z 2017-07-14T02:35:00Z", "2017-07-14T02:35:00Z 2017-07-14T02:40:00Z", "2017-07-14T02:40:00Z 2017-07-14T02:45:00Z"}; !reflect.DeepEqual(windows, expected) {
+		t.Errorf("The queried windows are %v, expected %v", windows, expected)
+	}
+	if len(client.events) != 2 {
+		t.Errorf("%d events were published, expected 2", len(client.events))
+	}
+	if ts := bt.state.GetGraphQLCheckpoint("zone/requests"); ts != int(time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC).Unix()) {
+		t.Errorf("The checkpoint is %s, expected it to stop before the failed window", time.Unix(int64(ts), 0).UTC())
+	}
+
+	// The failed window is queried again on the next run, along with the new ones
+	windows, failSince = nil, ""
+	bt.CollectGraphQLMetrics(now)
+	if expected := []string{"2017-07-14T02:40:00Z 2017-07-14T02:45:00Z", "2017-07-14T02:45:00Z 2017-07-14T02:50:00Z", "2017-07-14T02:50:00Z 2017-07-14T02:55:00Z", "2017-07-14T02:55:00Z 2017-07-14T03:00:00Z"}; !reflect.DeepEqual(windows, expected) {
+		t.Errorf("The queried windows are %v, expected %v", windows, expected)
+	}
+	if ts := bt.state.GetGraphQLCheckpoint("zone/requests"); ts != int(time.Date(2017, 7, 14, 3, 0, 0, 0, time.UTC).Unix()) {
+		t.Errorf("The checkpoint is %s, expected 03:00:00", time.Unix(int64(ts), 0).UTC())
+	}
+
+	// Nothing is moved when the rows can't be published
+	client.fail = true
+	bt.CollectGraphQLMetrics(now.Add(10 * time.Minute))
+	if ts := bt.state.GetGraphQLCheckpoint("zone/requests"); ts != int(time.Date(2017, 7, 14, 3, 0, 0, 0, time.UTC).Unix()) {
+		t.Errorf("The checkpoint moved to %s while the rows couldn't be published", time.Unix(int64(ts), 0).UTC())
+	}
+}
@@ -0,0 +1,128 @@
+package beater
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/publisher"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+)
+
+const (
+	HTTP_INPUT_READ_HEADER_TIMEOUT = 10 * time.Second
+	HTTP_INPUT_READ_TIMEOUT        = 5 * time.Minute
+	HTTP_INPUT_IDLE_TIMEOUT        = 2 * time.Minute
+)
+
+// runHTTPInput serves the HTTP endpoint to which Cloudflare Logpush pushes the logs, until the beat is stopped
+func (bt *Cloudflarebeat) runHTTPInput() error {
+
+	listener, err := net.Listen("tcp", bt.config.HTTPInputListen)
+	if err != nil {
+		return fmt.Errorf("Could not listen on %s: %v", bt.config.HTTPInputListen, err)
+	}
+
+	if bt.config.HTTPInputSSLCertificate != "" {
+		cert, err := tls.LoadX509KeyPair(bt.config.HTTPInputSSLCertificate, bt.config.HTTPInputSSLKey)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("Could not load the http input certificate: %v", err)
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(bt.config.HTTPInputPath, bt.handleLogpushRequest)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: HTTP_INPUT_READ_HEADER_TIMEOUT,
+		ReadTimeout:       HTTP_INPUT_READ_TIMEOUT,
+		IdleTimeout:       HTTP_INPUT_IDLE_TIMEOUT,
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	logp.Info("Accepting Logpush requests on %s%s", bt.config.HTTPInputListen, bt.config.HTTPInputPath)
+
+	select {
+	case <-bt.done:
+		listener.Close()
+		return nil
+	case err := <-served:
+		return err
+	}
+}
+
+// handleLogpushRequest converts the logs of a Logpush request into events, and only responds with a 200 status
+// once all of them are acknowledged by the output so that Cloudflare retries the failed requests
+func (bt *Cloudflarebeat) handleLogpushRequest(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !bt.isAuthorized(r) {
+		logp.Warn("Rejected unauthorized Logpush request from %s", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.ContentLength > bt.config.HTTPInputMaxBodySize {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	sourceName := fmt.Sprintf("logpush_http_%d", time.Now().UTC().UnixNano())
+	body := http.MaxBytesReader(w, r.Body, bt.config.HTTPInputMaxBodySize)
+	events, rayIDs, err := bt.logConsumer.BuildEvents(sourceName, body, bt.config.HTTPInputMaxBodySize)
+	// The error returned by MaxBytesReader isn't exported, hence the comparison of its message
+	if err == cloudflare.ErrLogTooLarge || (err != nil && err.Error() == "http: request body too large") {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		logp.Err("Could not read the Logpush request from %s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The Ray IDs are forgotten when the events can't be published, so that they aren't dropped as duplicates when
+	// Cloudflare retries the request
+	if len(events) > 0 && !bt.client.PublishEvents(events, publisher.Sync) {
+		logp.Err("Could not publish the %d events of the Logpush request", len(events))
+		bt.logConsumer.ForgetRayIDs(rayIDs)
+		http.Error(w, "Could not publish the events", http.StatusServiceUnavailable)
+		return
+	}
+
+	logp.Debug("http", "Published %d events from the Logpush request", len(events))
+	w.WriteHeader(http.StatusOK)
+}
+
+// isAuthorized verifies the shared secret header or the basic auth credentials of the request, whichever are configured
+func (bt *Cloudflarebeat) isAuthorized(r *http.Request) bool {
+
+	if bt.config.HTTPInputSecret != "" {
+		secret := r.Header.Get(bt.config.HTTPInputSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(bt.config.HTTPInputSecret)) != 1 {
+			return false
+		}
+	}
+
+	if bt.config.HTTPInputUsername != "" {
+		username, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(bt.config.HTTPInputUsername)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(bt.config.HTTPInputPassword)) != 1 {
+			return false
+		}
+	}
+
+	return true
+}
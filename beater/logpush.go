@@ -0,0 +1,165 @@
+package beater
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+const (
+	LOGPUSH_BATCH_SIZE   = 100
+	LOGPUSH_MAX_ATTEMPTS = 3
+)
+
+// logpushObjects lists, downloads and marks the objects pushed by Cloudflare Logpush, as done by a
+// cloudflare.LogpushBucket
+type logpushObjects interface {
+	ListNewObjects(prefix string, startAfter string, maxKeys int) ([]string, error)
+	Download(key string, dir string) (string, error)
+	Delete(key string) error
+	Tag(key string) error
+}
+
+// runLogpushInput periodically processes the new objects pushed by Cloudflare Logpush under each of the
+// configured S3 prefixes
+func (bt *Cloudflarebeat) runLogpushInput() error {
+
+	logp.Info("Processing Logpush objects from S3 bucket %s with prefixes %v", bt.config.LogpushS3BucketName, bt.config.LogpushS3Prefixes)
+	ticker := time.NewTicker(bt.config.LogpushS3ScanFrequency)
+	defer ticker.Stop()
+
+	for {
+		for _, prefix := range bt.config.LogpushS3Prefixes {
+			// Keep going through the batches until the prefix is caught up
+			for {
+				if bt.ProcessLogpushPrefix(prefix) < LOGPUSH_BATCH_SIZE {
+					break
+				}
+			}
+		}
+
+		select {
+		case <-bt.done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessLogpushPrefix downloads, processes and publishes the next batch of Logpush objects under the prefix, one at
+// a time and in order. The key of each object is recorded in the state file once it's processed, and the number of
+// processed objects is returned.
+func (bt *Cloudflarebeat) ProcessLogpushPrefix(prefix string) int {
+	return bt.processLogpushPrefix(prefix, bt.publishLocalFiles)
+}
+
+// processLogpushPrefix processes the next batch of Logpush objects under the prefix, publishing the file of each
+// object with the given function before moving on to the next one. An object which can't be downloaded or processed
+// stops the batch, so that the objects after it are neither published nor recorded until it's done, until it has
+// failed LOGPUSH_MAX_ATTEMPTS times in a row. It's then dead-lettered and skipped, so that a single corrupt object
+// never blocks the prefix.
+func (bt *Cloudflarebeat) processLogpushPrefix(prefix string, publish func([]string) ([]string, []string, bool)) int {
+
+	keys, err := bt.logpush.ListNewObjects(prefix, bt.state.GetLogpushLastKey(prefix), LOGPUSH_BATCH_SIZE)
+	if err != nil {
+		logp.Err("Could not list the Logpush objects with prefix '%s': %v", prefix, err)
+		return 0
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+
+	tmpDir, err := ioutil.TempDir("", "cloudflarebeat-logpush")
+	if err != nil {
+		logp.Err("Could not create a temporary directory for the Logpush objects: %v", err)
+		return 0
+	}
+	defer os.RemoveAll(tmpDir)
+
+	logp.Info("Processing %d Logpush object(s) with prefix '%s'", len(keys), prefix)
+	processed := 0
+	for _, key := range keys {
+		ok, reason := bt.processLogpushObject(key, tmpDir, publish)
+		if !ok {
+			break
+		}
+		if reason != nil {
+			bt.logpushAttempts[key]++
+			if bt.logpushAttempts[key] < LOGPUSH_MAX_ATTEMPTS {
+				logp.Err("Could not process Logpush object %s (attempt %d of %d), it will be retried on the next scan", key, bt.logpushAttempts[key], LOGPUSH_MAX_ATTEMPTS)
+				break
+			}
+			bt.deadLetterLogpushObject(key, reason)
+		} else {
+			bt.afterLogpushObjectProcessed(key)
+		}
+		delete(bt.logpushAttempts, key)
+		processed++
+
+		bt.state.UpdateLogpushLastKey(prefix, key)
+		if err := bt.state.Save(); err != nil {
+			logp.Info("[ERROR] Could not persist state file to storage: %s", err.Error())
+		}
+	}
+
+	return processed
+}
+
+// processLogpushObject downloads and publishes a single Logpush object, returning why it failed if it did. False is
+// returned when the beat is stopped before its events are acknowledged, in which case it's neither done nor failed.
+func (bt *Cloudflarebeat) processLogpushObject(key string, dir string, publish func([]string) ([]string, []string, bool)) (bool, error) {
+
+	f, err := bt.logpush.Download(key, dir)
+	if err != nil {
+		logp.Err("Could not download Logpush object %s: %v", key, err)
+		return true, err
+	}
+	defer os.Remove(f)
+
+	bt.logConsumer.SetFileSource(f, bt.logpushObjectURL(key))
+	completed, _, ok := publish([]string{f})
+	if !ok {
+		return false, nil
+	}
+	if len(completed) != 1 || completed[0] != f {
+		return true, errors.New("Could not process all of the log lines")
+	}
+	return true, nil
+}
+
+// deadLetterLogpushObject records the Logpush object which is skipped after failing too many times in the dead-letter
+// file, where it can be found to be processed again by hand. The object itself is left in the bucket as is.
+func (bt *Cloudflarebeat) deadLetterLogpushObject(key string, reason error) {
+
+	source := bt.logpushObjectURL(key)
+	logp.Err("Skipping Logpush object %s after %d failed attempts: %v", source, LOGPUSH_MAX_ATTEMPTS, reason)
+	if bt.logConsumer.DeadLetterFile == nil {
+		return
+	}
+	if err := bt.logConsumer.DeadLetterFile.Write(source, 0, nil, reason); err != nil {
+		logp.Err("Could not write to the dead-letter file: %v", err)
+	}
+}
+
+func (bt *Cloudflarebeat) logpushObjectURL(key string) string {
+	return "s3://" + bt.config.LogpushS3BucketName + "/" + key
+}
+
+// afterLogpushObjectProcessed applies the configured logpush_s3_after_processing action to the object
+func (bt *Cloudflarebeat) afterLogpushObjectProcessed(key string) {
+
+	var err error
+	switch bt.config.LogpushS3AfterProcessing {
+	case "delete":
+		err = bt.logpush.Delete(key)
+	case "tag":
+		err = bt.logpush.Tag(key)
+	}
+
+	if err != nil {
+		logp.Err("Could not %s Logpush object %s: %v", bt.config.LogpushS3AfterProcessing, key, err)
+	}
+}
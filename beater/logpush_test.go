@@ -0,0 +1,204 @@
+//go:build !integration
+// +build !integration
+
+package beater
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+// memoryLogpushObjects is an in-memory bucket of Logpush objects
+type memoryLogpushObjects struct {
+	objects        map[string]string
+	downloadErrors map[string]bool
+}
+
+func (m *memoryLogpushObjects) ListNewObjects(prefix string, startAfter string, maxKeys int) ([]string, error) {
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) && key > startAfter {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+	}
+	return keys, nil
+}
+
+func (m *memoryLogpushObjects) Download(key string, dir string) (string, error) {
+	if m.downloadErrors[key] {
+		return "", errors.New("Download failed")
+	}
+	filename := filepath.Join(dir, strings.Replace(key, "/", "_", -1))
+	return filename, ioutil.WriteFile(filename, []byte(m.objects[key]), 0644)
+}
+
+func (m *memoryLogpushObjects) Delete(key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryLogpushObjects) Tag(key string) error {
+	return nil
+}
+
+// publishTestFiles completes the files unless their content is "corrupt"
+func publishTestFiles(files []string) ([]string, []string, bool) {
+	completed, failed := []string{}, []string{}
+	for _, f := range files {
+		if data, err := ioutil.ReadFile(f); err != nil || string(data) == "corrupt" {
+			failed = append(failed, f)
+		} else {
+			completed = append(completed, f)
+		}
+	}
+	return completed, failed, true
+}
+
+func newTestLogpushBeat(t *testing.T, dir string, bucket *memoryLogpushObjects) *Cloudflarebeat {
+	sf, err := cloudflare.NewStateFile(map[string]string{
+		"filename":     "cloudflarebeat",
+		"filepath":     dir,
+		"zone_tag":     "zone",
+		"storage_type": "disk",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig
+	cfg.LogpushS3BucketName = "bucket"
+	cfg.LogpushS3AfterProcessing = "delete"
+	return &Cloudflarebeat{
+		config:          cfg,
+		state:           sf,
+		logConsumer:     cloudflare.NewLogConsumer("", "", 1, 1, 1),
+		logpush:         bucket,
+		logpushAttempts: map[string]int{},
+	}
+}
+
+func TestProcessLogpushPrefixPublishesObjectsOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-logpush-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bucket := &memoryLogpushObjects{
+		objects: map[string]string{
+			"logs/a.log.gz": "a",
+			"logs/b.log.gz": "corrupt",
+			"logs/c.log.gz": "c",
+			"logs/d.log.gz": "d",
+		},
+	}
+	bt := newTestLogpushBeat(t, dir, bucket)
+
+	// Count how many times the events of each object are published
+	published := map[string]int{}
+	publish := func(files []string) ([]string, []string, bool) {
+		if len(files) != 1 {
+			t.Errorf("Expected the objects to be published one at a time, got %v", files)
+		}
+		for _, f := range files {
+			if data, err := ioutil.ReadFile(f); err == nil && string(data) != "corrupt" {
+				published[string(data)]++
+			}
+		}
+		return publishTestFiles(files)
+	}
+
+	for i := 0; i < LOGPUSH_MAX_ATTEMPTS+1; i++ {
+		bt.processLogpushPrefix("logs/", publish)
+	}
+
+	for _, object := range []string{"a", "c", "d"} {
+		if published[object] != 1 {
+			t.Errorf("The events of object %s were published %d times, expected once", object, published[object])
+		}
+	}
+	if lastKey := bt.state.GetLogpushLastKey("logs/"); lastKey != "logs/d.log.gz" {
+		t.Errorf("Last key is %s, expected logs/d.log.gz", lastKey)
+	}
+}
+
+func TestProcessLogpushPrefixSkipsFailingObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-logpush-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dlf, err := cloudflare.NewDeadLetterFile(dir, "dead-letter.ndjson", 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := &memoryLogpushObjects{
+		objects: map[string]string{
+			"logs/a.log.gz": "{}",
+			"logs/b.log.gz": "corrupt",
+			"logs/c.log.gz": "{}",
+			"logs/d.log.gz": "{}",
+			"logs/e.log.gz": "{}",
+			"other/f.log":   "{}",
+		},
+		downloadErrors: map[string]bool{"logs/d.log.gz": true},
+	}
+	bt := newTestLogpushBeat(t, dir, bucket)
+	bt.logConsumer.DeadLetterFile = dlf
+	sf := bt.state
+
+	// Each failing object is retried until its last attempt, then skipped
+	steps := []struct {
+		processed int
+		lastKey   string
+	}{
+		{1, "logs/a.log.gz"},
+		{0, "logs/a.log.gz"},
+		{2, "logs/c.log.gz"},
+		{0, "logs/c.log.gz"},
+		{2, "logs/e.log.gz"},
+		{0, "logs/e.log.gz"},
+	}
+	for i, step := range steps {
+		processed := bt.processLogpushPrefix("logs/", publishTestFiles)
+		if processed != step.processed {
+			t.Errorf("Scan %d processed %d objects, expected %d", i+1, processed, step.processed)
+		}
+		if lastKey := sf.GetLogpushLastKey("logs/"); lastKey != step.lastKey {
+			t.Errorf("Last key after scan %d is %s, expected %s", i+1, lastKey, step.lastKey)
+		}
+	}
+
+	// The processed objects are deleted, while the skipped ones are left in place and dead-lettered
+	remaining := []string{}
+	for key := range bucket.objects {
+		remaining = append(remaining, key)
+	}
+	sort.Strings(remaining)
+	if expected := "logs/b.log.gz logs/d.log.gz other/f.log"; strings.Join(remaining, " ") != expected {
+		t.Errorf("The remaining objects are %v, expected %s", remaining, expected)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dead-letter.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "s3://bucket/logs/b.log.gz") || !strings.Contains(string(data), "s3://bucket/logs/d.log.gz") {
+		t.Errorf("The skipped objects weren't dead-lettered: %s", data)
+	}
+	if len(bt.logpushAttempts) != 0 {
+		t.Errorf("The attempts of the skipped objects weren't cleared: %v", bt.logpushAttempts)
+	}
+}
@@ -0,0 +1,51 @@
+package beater
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/publisher"
+)
+
+// OneShot is a beater which publishes a fixed set of events to the configured output and then exits. It allows the
+// subcommands to publish events with the same output and processors as the beat.
+type OneShot struct {
+	events    []common.MapStr
+	client    publisher.Client
+	closeOnce sync.Once
+}
+
+// NewOneShot returns the creator of a OneShot beater publishing the given events
+func NewOneShot(events []common.MapStr) beat.Creator {
+	return func(b *beat.Beat, cfg *common.Config) (beat.Beater, error) {
+		return &OneShot{events: events}, nil
+	}
+}
+
+func (o *OneShot) Run(b *beat.Beat) error {
+	o.client = b.Publisher.Connect()
+	defer o.closeClient()
+
+	if !o.client.PublishEvents(o.events, publisher.Sync) {
+		return errors.New("Could not publish the events to the output")
+	}
+
+	logp.Info("Published %d events", len(o.events))
+	return nil
+}
+
+func (o *OneShot) Stop() {
+	o.closeClient()
+}
+
+// closeClient closes the publisher client once, whether Run returns or the beat is stopped first
+func (o *OneShot) closeClient() {
+	o.closeOnce.Do(func() {
+		if o.client != nil {
+			o.client.Close()
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	ACCOUNT_AUDIT_LOGS_URI = "/client/v4/accounts/%s/audit_logs"
+	USER_AUDIT_LOGS_URI    = "/client/v4/user/audit_logs"
+)
+
+// AuditLog is an entry of the Cloudflare account or user audit logs
+type AuditLog struct {
+	ID     string `json:"id"`
+	Action struct {
+		Type   string `json:"type"`
+		Result bool   `json:"result"`
+	} `json:"action"`
+	Actor struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+		Type  string `json:"type"`
+	} `json:"actor"`
+	Interface string `json:"interface"`
+	Owner     struct {
+		ID string `json:"id"`
+	} `json:"owner"`
+	Resource struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"resource"`
+	Metadata map[string]interface{} `json:"metadata"`
+	NewValue interface{}            `json:"newValue"`
+	OldValue interface{}            `json:"oldValue"`
+	When     string                 `json:"when"`
+}
+
+type auditLogsResponse struct {
+	Success bool       `json:"success"`
+	Errors  []apiError `json:"errors"`
+	Result  []AuditLog `json:"result"`
+}
+
+// GetAuditLogs returns a page of the audit log entries from the since time onwards and older than the before time, in
+// chronological order. Bounding the window keeps the pages stable while new entries are added. The account audit
+// logs are returned when an account ID is given, otherwise the audit logs of the user.
+func (c *CloudflareClient) GetAuditLogs(accountID string, since time.Time, before time.Time, page int, perPage int) ([]AuditLog, error) {
+
+	uri := USER_AUDIT_LOGS_URI
+	if accountID != "" {
+		uri = fmt.Sprintf(ACCOUNT_AUDIT_LOGS_URI, accountID)
+	}
+
+	qsa := url.Values{}
+	qsa.Set("since", since.UTC().Format(time.RFC3339))
+	qsa.Set("before", before.UTC().Format(time.RFC3339))
+	qsa.Set("direction", "asc")
+	qsa.Set("page", fmt.Sprintf("%d", page))
+	qsa.Set("per_page", fmt.Sprintf("%d", perPage))
+
+	resp := auditLogsResponse{}
+	if err := c.getJSON(uri, qsa, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("Audit logs request failed: %v", resp.Errors)
+	}
+
+	return resp.Result, nil
+}
+
+// AuditLogFilter drops the audit log entries which were already published, based on the checkpoint made of the time
+// of the last published entry and the IDs of all the entries published with that same time
+type AuditLogFilter struct {
+	LastWhen time.Time
+	LastIDs  map[string]bool
+}
+
+// NewAuditLogFilter returns a new instance of an AuditLogFilter struct from the given checkpoint
+func NewAuditLogFilter(lastWhen time.Time, lastIDs []string) *AuditLogFilter {
+	f := &AuditLogFilter{
+		LastWhen: lastWhen,
+		LastIDs:  map[string]bool{},
+	}
+	for _, id := range lastIDs {
+		f.LastIDs[id] = true
+	}
+	return f
+}
+
+// Accept returns true if the entry wasn't published yet, and moves the checkpoint to the entry if so
+func (f *AuditLogFilter) Accept(when time.Time, id string) bool {
+
+	if when.Before(f.LastWhen) || (when.Equal(f.LastWhen) && f.LastIDs[id]) {
+		return false
+	}
+
+	if !when.Equal(f.LastWhen) {
+		f.LastWhen = when
+		f.LastIDs = map[string]bool{}
+	}
+	f.LastIDs[id] = true
+
+	return true
+}
+
+// Checkpoint returns the time of the last accepted entry and the IDs of the entries accepted with that same time
+func (f *AuditLogFilter) Checkpoint() (time.Time, []string) {
+	ids := []string{}
+	for id := range f.LastIDs {
+		ids = append(ids, id)
+	}
+	return f.LastWhen, ids
+}
+
+// ParseAuditLogTime parses the time at which an audit log entry occurred
+func ParseAuditLogTime(when string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, when)
+}
+
+// BuildAuditMapStr builds the event to be published for an audit log entry
+func BuildAuditMapStr(al AuditLog, when time.Time) common.MapStr {
+
+	actor := common.MapStr{
+		"id":    al.Actor.ID,
+		"email": al.Actor.Email,
+		"type":  al.Actor.Type,
+	}
+	// Empty strings are omitted as they can't be indexed as an ip field
+	if al.Actor.IP != "" {
+		actor["ip"] = al.Actor.IP
+	}
+
+	audit := common.MapStr{
+		"id":        al.ID,
+		"action":    common.MapStr{"type": al.Action.Type, "result": al.Action.Result},
+		"actor":     actor,
+		"interface": al.Interface,
+		"owner":     common.MapStr{"id": al.Owner.ID},
+		"resource":  common.MapStr{"id": al.Resource.ID, "type": al.Resource.Type},
+	}
+	if len(al.Metadata) > 0 {
+		audit["metadata"] = al.Metadata
+	}
+	// The values can be of any type depending on the resource, so they're always indexed as strings
+	if v := auditValueString(al.NewValue); v != "" {
+		audit["newValue"] = v
+	}
+	if v := auditValueString(al.OldValue); v != "" {
+		audit["oldValue"] = v
+	}
+
+	return common.MapStr{
+		"@timestamp": common.Time(when),
+		"type":       "cloudflare_audit",
+		"audit":      audit,
+	}
+}
+
+func auditValueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,87 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGetAuditLogs(t *testing.T) {
+	tests := []struct {
+		accountID string
+		path      string
+	}{
+		{"acct", "/client/v4/accounts/acct/audit_logs"},
+		{"", "/client/v4/user/audit_logs"},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != test.path {
+				t.Errorf("Unexpected path %s, expected %s", r.URL.Path, test.path)
+			}
+			q := r.URL.Query()
+			if q.Get("since") != "2017-07-14T02:40:00Z" || q.Get("before") != "2017-07-14T02:45:00Z" || q.Get("direction") != "asc" || q.Get("page") != "2" || q.Get("per_page") != "50" {
+				t.Errorf("Unexpected query %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"success": true, "result": [{"id": "a", "when": "2017-07-14T02:41:00Z", "action": {"type": "login", "result": true}}]}`)
+		}))
+
+		c := NewClient(map[string]interface{}{"api_key": "key", "email": "user@example.com", "api_base": server.URL})
+		since := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+		entries, err := c.GetAuditLogs(test.accountID, since, since.Add(5*time.Minute), 2, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].ID != "a" || entries[0].Action.Type != "login" || !entries[0].Action.Result {
+			t.Errorf("Unexpected entries %+v", entries)
+		}
+		server.Close()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}]}`)
+	}))
+	defer server.Close()
+	c := NewClient(map[string]interface{}{"api_key": "key", "email": "user@example.com", "api_base": server.URL})
+	if _, err := c.GetAuditLogs("acct", time.Unix(0, 0), time.Unix(60, 0), 1, 50); err == nil {
+		t.Errorf("Expected an error for an unsuccessful response")
+	}
+}
+
+func TestAuditLogFilter(t *testing.T) {
+	t0 := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	f := NewAuditLogFilter(t0, []string{"a"})
+
+	tests := []struct {
+		when     time.Time
+		id       string
+		expected bool
+	}{
+		{t0.Add(-time.Second), "old", false},
+		{t0, "a", false},
+		{t0, "b", true},
+		{t0, "b", false},
+		{t0.Add(time.Second), "c", true},
+		{t0, "d", false},
+		{t0.Add(time.Second), "e", true},
+	}
+	for _, test := range tests {
+		if accepted := f.Accept(test.when, test.id); accepted != test.expected {
+			t.Errorf("Expected Accept(%s, %s) to be %v", test.when, test.id, test.expected)
+		}
+	}
+
+	when, ids := f.Checkpoint()
+	sort.Strings(ids)
+	if !when.Equal(t0.Add(time.Second)) || !reflect.DeepEqual(ids, []string{"c", "e"}) {
+		t.Errorf("Unexpected checkpoint %s %v", when, ids)
+	}
+}
@@ -0,0 +1,55 @@
+package cloudflare
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+type awsS3Settings struct {
+	awsAccesKey        string
+	awsSecretAccessKey string
+	s3BucketName       string
+	region             string
+	endpoint           string // Only set for S3 compatible storage such as MinIO
+}
+
+// newS3Service returns an S3 client for the given settings. When no access key is set, the credentials are
+// taken from the environment or the instance role.
+func newS3Service(settings *awsS3Settings) (*s3.S3, error) {
+
+	sess := session.New(&aws.Config{
+		Region: aws.String(settings.region),
+	})
+
+	/*
+		Or with debugging on:
+		sess := session.New((&aws.Config{
+			Region: aws.String("us-east-1"),
+		}).WithLogLevel(aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors))
+	*/
+
+	cfg := &aws.Config{
+		Region: aws.String(settings.region),
+	}
+
+	if settings.awsAccesKey != "" {
+		token := ""
+		creds := credentials.NewStaticCredentials(settings.awsAccesKey, settings.awsSecretAccessKey, token)
+		_, err := creds.Get()
+		if err != nil {
+			logp.Info("[ERROR] AWS Credentials: %v", err)
+			return nil, err
+		}
+		cfg.Credentials = creds
+	}
+
+	if settings.endpoint != "" {
+		cfg.Endpoint = aws.String(settings.endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	return s3.New(sess, cfg), nil
+}
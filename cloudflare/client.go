@@ -2,8 +2,12 @@ package cloudflare
 
 import (
 	//"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elastic/beats/libbeat/logp"
@@ -15,9 +19,13 @@ import (
 **/
 
 const (
-	API_BASE = "https://api.cloudflare.com"
+	API_BASE              = "https://api.cloudflare.com"
+	LOG_RETENTION_SECONDS = 72 * 60 * 60 // Logs can only be retrieved from the ELS API for up to 72 hours
 )
 
+// ErrRayIDNotFound is returned when the logs have no record of the requested Ray ID
+var ErrRayIDNotFound = errors.New("Ray ID not found")
+
 type CloudflareClient struct {
 	ApiKey         string
 	Email          string
@@ -25,6 +33,7 @@ type CloudflareClient struct {
 	RequestLogFile *RequestLogFile
 	LogfileName    string
 	uri            string
+	apiBase        string
 	debug          bool
 }
 
@@ -32,7 +41,8 @@ type CloudflareClient struct {
 func NewClient(params map[string]interface{}) *CloudflareClient {
 
 	c := &CloudflareClient{
-		uri: "/client/v4/zones/%s/logs/requests",
+		uri:     "/client/v4/zones/%s/logs/requests",
+		apiBase: API_BASE,
 	}
 
 	if _, ok := params["api_key"]; ok {
@@ -46,13 +56,17 @@ func NewClient(params map[string]interface{}) *CloudflareClient {
 		c.debug = params["debug"].(bool)
 	}
 
+	if _, ok := params["api_base"]; ok {
+		c.apiBase = params["api_base"].(string)
+	}
+
 	return c
 }
 
 func (c *CloudflareClient) doRequest(params map[string]interface{}) (string, error) {
 
 	qsa := url.Values{}
-	apiURL := API_BASE + fmt.Sprintf(c.uri, params["zone_tag"].(string))
+	apiURL := c.apiBase + fmt.Sprintf(c.uri, params["zone_tag"].(string))
 
 	if _, ok := params["time_start"]; ok {
 		qsa.Set("start", fmt.Sprintf("%d", params["time_start"].(int)))
@@ -63,6 +77,12 @@ func (c *CloudflareClient) doRequest(params map[string]interface{}) (string, err
 	if _, ok := params["count"]; ok {
 		qsa.Set("count", fmt.Sprintf("%d", params["count"].(int)))
 	}
+	if sample, ok := params["sample"].(float64); ok && sample > 0 && sample < 1 {
+		qsa.Set("sample", strconv.FormatFloat(sample, 'f', -1, 64))
+	}
+	if fields, ok := params["fields"].([]string); ok && len(fields) > 0 {
+		qsa.Set("fields", strings.Join(fields, ","))
+	}
 
 	req := goreq.Request{
 		Uri:         apiURL,
@@ -72,12 +92,7 @@ func (c *CloudflareClient) doRequest(params map[string]interface{}) (string, err
 	}
 
 	req.AddHeader("Accept-encoding", "gzip")
-	if c.UserServiceKey != "" {
-		req.AddHeader("X-User-Service-Key", c.UserServiceKey)
-	} else {
-		req.AddHeader("X-Auth-Key", c.ApiKey)
-		req.AddHeader("X-Auth-Email", c.Email)
-	}
+	c.addAuthHeaders(&req)
 
 	logp.Debug("http", "Downloading log file...")
 
@@ -85,6 +100,13 @@ func (c *CloudflareClient) doRequest(params map[string]interface{}) (string, err
 	if err != nil {
 		return "", err
 	}
+	defer response.Body.Close()
+
+	// No content is returned when there are no logs for the time range
+	if response.StatusCode != 200 && response.StatusCode != 204 {
+		body, _ := response.Body.ToString()
+		return "", fmt.Errorf("Unexpected status %d from the ELS API: %s", response.StatusCode, body)
+	}
 
 	// Now need to save all the resposne content to a file
 	logFileName := fmt.Sprintf("cloudflare_logs_%d_to_%d.txt.gz", params["time_start"].(int), params["time_end"].(int))
@@ -99,6 +121,79 @@ func (c *CloudflareClient) doRequest(params map[string]interface{}) (string, err
 	return logFileName, nil
 }
 
+// addAuthHeaders sets the credentials of the client on the request
+func (c *CloudflareClient) addAuthHeaders(req *goreq.Request) {
+	if c.UserServiceKey != "" {
+		req.AddHeader("X-User-Service-Key", c.UserServiceKey)
+	} else {
+		req.AddHeader("X-Auth-Key", c.ApiKey)
+		req.AddHeader("X-Auth-Email", c.Email)
+	}
+}
+
+// getJSON performs a GET request to the given API path and decodes the JSON response into out
+func (c *CloudflareClient) getJSON(uri string, qsa url.Values, out interface{}) error {
+	return c.doJSONRequest("GET", uri, qsa, nil, out)
+}
+
+// postJSON performs a POST request with the JSON encoded body to the given API path and decodes the JSON response into out
+func (c *CloudflareClient) postJSON(uri string, body interface{}, out interface{}) error {
+	return c.doJSONRequest("POST", uri, nil, body, out)
+}
+
+func (c *CloudflareClient) doJSONRequest(method string, uri string, qsa url.Values, body interface{}, out interface{}) error {
+
+	req := goreq.Request{
+		Method:    method,
+		Uri:       c.apiBase + uri,
+		Timeout:   1 * time.Minute,
+		ShowDebug: c.debug,
+		Body:      body,
+	}
+	if qsa != nil {
+		req.QueryString = qsa
+	}
+	if body != nil {
+		req.ContentType = "application/json"
+	}
+	c.addAuthHeaders(&req)
+
+	response, err := req.Do()
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		respBody, _ := response.Body.ToString()
+		return fmt.Errorf("Unexpected status %d from %s: %s", response.StatusCode, uri, respBody)
+	}
+
+	return response.Body.FromJsonTo(out)
+}
+
+// GetLogFields returns the names and descriptions of the log fields available for the zone
+func (c *CloudflareClient) GetLogFields(zoneTag string) (map[string]string, error) {
+	fields := map[string]string{}
+	if err := c.getJSON(fmt.Sprintf("/client/v4/zones/%s/logs/received/fields", zoneTag), nil, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// GetLogByRayID returns the decoded log record of the request with the given Ray ID, or ErrRayIDNotFound if the API
+// returned no record for it
+func (c *CloudflareClient) GetLogByRayID(zoneTag string, rayID string) (map[string]interface{}, error) {
+	var l map[string]interface{}
+	err := c.getJSON(fmt.Sprintf("/client/v4/zones/%s/logs/rayids/%s", zoneTag, url.QueryEscape(rayID)), nil, &l)
+	if err == io.EOF || (err == nil && len(l) == 0) {
+		return nil, ErrRayIDNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
 func (c *CloudflareClient) GetLogRangeFromTimestamp(opts map[string]interface{}) (string, error) {
 	filename, err := c.doRequest(opts)
 	if err != nil {
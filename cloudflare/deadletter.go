@@ -0,0 +1,71 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+var deadLetterEvents = expvar.NewInt("cloudflarebeat.dead_letter_events")
+
+// DeadLetterEntry holds a raw log line which could not be converted into an event. The line is kept as bytes, which
+// are base64 encoded in the JSON, so that lines which aren't valid UTF-8 are stored unchanged.
+type DeadLetterEntry struct {
+	Timestamp  string `json:"@timestamp"`
+	Source     string `json:"source"`
+	LineNumber int    `json:"line_number"`
+	Error      string `json:"error"`
+	Line       []byte `json:"line"`
+}
+
+// DeadLetterFile writes the log lines which could not be processed to a rotating NDJSON file, so that they can be
+// replayed later on
+type DeadLetterFile struct {
+	rotator *logp.FileRotator
+	lock    sync.Mutex
+}
+
+// NewDeadLetterFile returns a new instance of a DeadLetterFile writing to the given directory
+func NewDeadLetterFile(path string, name string, rotateEveryKb int, numberOfFiles int) (*DeadLetterFile, error) {
+
+	rotateEveryBytes := uint64(rotateEveryKb) * 1024
+	rotator := &logp.FileRotator{
+		Path:             path,
+		Name:             name,
+		RotateEveryBytes: &rotateEveryBytes,
+		KeepFiles:        &numberOfFiles,
+	}
+
+	if err := rotator.CheckIfConfigSane(); err != nil {
+		return nil, err
+	}
+	if err := rotator.CreateDirectory(); err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterFile{rotator: rotator}, nil
+}
+
+// Write appends the log line to the dead-letter file along with its source and the reason it could not be processed.
+// The source identifies where the line can be fetched again, such as the time range of an API segment, the path of a
+// local file or the key of a Logpush object.
+func (d *DeadLetterFile) Write(source string, lineNumber int, line []byte, reason error) error {
+
+	data, err := json.Marshal(DeadLetterEntry{
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		Source:     source,
+		LineNumber: lineNumber,
+		Error:      reason.Error(),
+		Line:       line,
+	})
+	if err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.rotator.WriteLine(data)
+}
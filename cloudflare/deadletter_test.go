@@ -0,0 +1,46 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeadLetterFileKeepsRawBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-dead-letter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := NewDeadLetterFile(dir, "dead-letter.ndjson", 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte("{\"rayId\": \"\xff\xfe\"")
+	if err := d.Write("segment 1500000000 to 1500000599", 3, line, errors.New("Could not load JSON")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dead-letter.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry DeadLetterEntry
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Line) != string(line) {
+		t.Errorf("The line is %q, expected %q", entry.Line, line)
+	}
+	if entry.Source != "segment 1500000000 to 1500000599" || entry.LineNumber != 3 || entry.Error != "Could not load JSON" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
@@ -0,0 +1,69 @@
+package cloudflare
+
+import (
+	"sync"
+	"time"
+)
+
+// RayIDCache keeps track of the Ray IDs of the events seen within a sliding window of event time, so that the
+// duplicate events resulting from overlapping or re-fetched time ranges can be dropped
+type RayIDCache struct {
+	window    int64
+	seen      map[string]int64
+	newest    int64
+	lastPrune int64
+	lock      sync.Mutex
+}
+
+// NewRayIDCache returns a new instance of a RayIDCache which remembers the Ray IDs for the given window of event time
+func NewRayIDCache(window time.Duration) *RayIDCache {
+	return &RayIDCache{
+		window: int64(window),
+		seen:   map[string]int64{},
+	}
+}
+
+// Seen records the Ray ID of an event with the given nanosecond timestamp, and returns true if it was already recorded
+func (c *RayIDCache) Seen(rayID string, timestamp int64) bool {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.seen[rayID]; ok {
+		return true
+	}
+
+	c.seen[rayID] = timestamp
+	if timestamp > c.newest {
+		c.newest = timestamp
+	}
+
+	// Prune the Ray IDs that are now outside the window, at most twice per window
+	if c.newest-c.lastPrune > c.window/2 {
+		for id, ts := range c.seen {
+			if ts < c.newest-c.window {
+				delete(c.seen, id)
+			}
+		}
+		c.lastPrune = c.newest
+	}
+
+	return false
+}
+
+// Forget removes the given Ray IDs, so that the events which could not be published aren't considered duplicates
+// when they're received again
+func (c *RayIDCache) Forget(rayIDs []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, rayID := range rayIDs {
+		delete(c.seen, rayID)
+	}
+}
+
+// Len returns the number of Ray IDs currently being tracked
+func (c *RayIDCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.seen)
+}
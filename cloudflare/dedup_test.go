@@ -0,0 +1,107 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRayIDCacheWindow(t *testing.T) {
+	c := NewRayIDCache(10 * time.Second)
+	base := int64(1500000000 * time.Second)
+
+	if c.Seen("a", base) {
+		t.Error("The first event was reported as a duplicate")
+	}
+	if !c.Seen("a", base+int64(time.Second)) {
+		t.Error("The duplicate event within the window wasn't detected")
+	}
+	if c.Seen("b", base) {
+		t.Error("An event with a different Ray ID was reported as a duplicate")
+	}
+	if !c.Seen("b", base+int64(9*time.Second)) {
+		t.Error("The duplicate event at the end of the window wasn't detected")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Tracking %d Ray IDs, expected 2", c.Len())
+	}
+}
+
+func TestRayIDCacheEviction(t *testing.T) {
+	c := NewRayIDCache(10 * time.Second)
+	base := int64(1500000000 * time.Second)
+
+	c.Seen("a", base)
+	c.Seen("b", base+int64(4*time.Second))
+	if c.Len() != 2 {
+		t.Fatalf("Tracking %d Ray IDs, expected 2", c.Len())
+	}
+
+	// Moving the window past the first events evicts them
+	c.Seen("c", base+int64(12*time.Second))
+	if c.Len() != 2 {
+		t.Errorf("Tracking %d Ray IDs after the first prune, expected 2", c.Len())
+	}
+	if c.Seen("a", base+int64(13*time.Second)) {
+		t.Error("The evicted Ray ID was reported as a duplicate")
+	}
+	if !c.Seen("b", base+int64(13*time.Second)) {
+		t.Error("The Ray ID still within the window was evicted")
+	}
+
+	c.Seen("d", base+int64(60*time.Second))
+	if c.Len() != 1 {
+		t.Errorf("Tracking %d Ray IDs after the window moved on, expected 1", c.Len())
+	}
+}
+
+func TestProcessLogLineWithoutTimestamp(t *testing.T) {
+	lc := &LogConsumer{RayIDCache: NewRayIDCache(time.Minute), SampleRate: 1}
+
+	if _, _, err := lc.processLogLine([]byte(`{"rayId": "abc", "timestamp": 1500000000000000000}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := lc.processLogLine([]byte(`{"rayId": "abc", "timestamp": 1500000001000000000}`)); err != errDuplicateEvent {
+		t.Errorf("The duplicate event wasn't dropped: %v", err)
+	}
+
+	// The record is rejected without panicking, and isn't recorded as seen
+	if _, _, err := lc.processLogLine([]byte(`{"rayId": "def"}`)); err == nil || err == errDuplicateEvent {
+		t.Errorf("The record without a timestamp wasn't rejected: %v", err)
+	}
+	if _, _, err := lc.processLogLine([]byte(`{"rayId": "def", "timestamp": "1500000000"}`)); err == nil || err == errDuplicateEvent {
+		t.Errorf("The record with an invalid timestamp wasn't rejected: %v", err)
+	}
+	if c := lc.RayIDCache.Len(); c != 1 {
+		t.Errorf("Tracking %d Ray IDs, expected 1", c)
+	}
+}
+
+func TestBuildEventsForgetsRayIDs(t *testing.T) {
+	lc := &LogConsumer{RayIDCache: NewRayIDCache(time.Minute), SampleRate: 1}
+	body := `{"rayId": "abc", "timestamp": 1500000000000000000}
+{"rayId": "def", "timestamp": 1500000001000000000}
+{"rayId": "abc", "timestamp": 1500000002000000000}
+`
+
+	events, rayIDs, err := lc.BuildEvents("test", strings.NewReader(body), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || strings.Join(rayIDs, " ") != "abc def" {
+		t.Fatalf("Got %d events with the Ray IDs %v, expected 2 with abc and def", len(events), rayIDs)
+	}
+
+	// When the publishing fails, the retried request isn't dropped as duplicates
+	lc.ForgetRayIDs(rayIDs)
+	events, _, err = lc.BuildEvents("test", strings.NewReader(body), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Got %d events from the retried request, expected 2", len(events))
+	}
+}
@@ -0,0 +1,165 @@
+package cloudflare
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const ECS_VERSION = "1.12.0"
+
+// ecsFields lists the fields of the request log events which are moved to their Elastic Common Schema equivalent.
+// When several fields have the same equivalent, the last one which is set wins, so the GeoIP fields come before the
+// ones provided by Cloudflare.
+var ecsFields = []struct {
+	From string
+	To   string
+}{
+	{"client.geo.cityName", "source.geo.city_name"},
+	{"client.geo.regionName", "source.geo.region_name"},
+	{"client.geo.regionIsoCode", "source.geo.region_iso_code"},
+	{"client.geo.countryIsoCode", "source.geo.country_iso_code"},
+	{"client.geo.countryName", "source.geo.country_name"},
+	{"client.geo.continentName", "source.geo.continent_name"},
+	{"client.geo.location", "source.geo.location"},
+	{"client.geo.asNumber", "source.as.number"},
+	{"client.geo.asOrganization", "source.as.organization.name"},
+	{"client.ip", "source.ip"},
+	{"client.srcPort", "source.port"},
+	{"client.asNum", "source.as.number"},
+	{"clientRequest.httpHost", "url.domain"},
+	{"clientRequest.uri", "url.original"},
+	{"clientRequest.path", "url.path"},
+	{"clientRequest.query", "url.query"},
+	{"clientRequest.extension", "url.extension"},
+	{"clientRequest.scheme", "url.scheme"},
+	{"clientRequest.userAgent", "user_agent.original"},
+	{"clientRequest.referer", "http.request.referrer"},
+	{"clientRequest.bytes", "http.request.bytes"},
+	{"clientRequest.bodyBytes", "http.request.body.bytes"},
+	{"clientRequest.httpMethod", "http.request.method"},
+	{"edgeRequest.httpMethod", "http.request.method"},
+	{"edgeResponse.status", "http.response.status_code"},
+	{"edgeResponse.bytes", "http.response.bytes"},
+	{"edgeResponse.bodyBytes", "http.response.body.bytes"},
+	{"edgeResponse.contentType", "http.response.mime_type"},
+	{"ownerId", "cloud.account.id"},
+	{"rayId", "event.id"},
+}
+
+// ToECS maps a request log event to the Elastic Common Schema. The fields without an ECS equivalent are kept under
+// the cloudflare object, so that no information is lost.
+func ToECS(evt common.MapStr) common.MapStr {
+	out := common.MapStr{
+		"@timestamp": evt["@timestamp"],
+		"type":       evt["type"],
+		"ecs":        common.MapStr{"version": ECS_VERSION},
+		"event": common.MapStr{
+			"kind":     "event",
+			"category": []string{"web"},
+			"type":     []string{"access"},
+			"module":   "cloudflare",
+			"dataset":  "cloudflare.requests",
+		},
+		"cloud": common.MapStr{"provider": "cloudflare"},
+	}
+	delete(evt, "@timestamp")
+	delete(evt, "type")
+
+	for _, f := range ecsFields {
+		if v := popValue(evt, f.From); v != nil {
+			out.Put(f.To, v)
+		}
+	}
+
+	if country, ok := popValue(evt, "client.country").(string); ok && country != "" {
+		out.Put("source.geo.country_iso_code", strings.ToUpper(country))
+	}
+	if colo := popValue(evt, "edge.colo"); colo != nil {
+		out.Put("cloud.availability_zone", fmt.Sprint(colo))
+	}
+	if protocol, ok := popValue(evt, "clientRequest.httpProtocol").(string); ok && protocol != "" {
+		out.Put("http.version", strings.TrimPrefix(protocol, "HTTP/"))
+	}
+
+	// Split the URI into its path and query unless it was already parsed, and rebuild the full URL when the scheme is
+	// known
+	if uri, ok := getString(out, "url.original"); ok && uri != "" {
+		if _, parsed := getString(out, "url.path"); !parsed {
+			if u, err := url.ParseRequestURI(uri); err == nil {
+				out.Put("url.path", u.Path)
+				if u.RawQuery != "" {
+					out.Put("url.query", u.RawQuery)
+				}
+			}
+		}
+		scheme, _ := getString(out, "url.scheme")
+		domain, _ := getString(out, "url.domain")
+		if scheme != "" && domain != "" {
+			out.Put("url.full", scheme+"://"+domain+uri)
+		}
+	}
+
+	// The edge timestamps are kept, as they're in milliseconds while event.duration is in nanoseconds
+	if duration := popValue(evt, "event.duration"); duration != nil {
+		out.Put("event.duration", duration)
+	}
+	delete(evt, "event")
+
+	// The parsed user agent already follows the Elastic Common Schema
+	if ua, ok := evt["user_agent"].(common.MapStr); ok {
+		for k, v := range ua {
+			out.Put("user_agent."+k, v)
+		}
+		delete(evt, "user_agent")
+	}
+
+	pruneEmpty(evt)
+	if len(evt) > 0 {
+		out["cloudflare"] = evt
+	}
+
+	return out
+}
+
+// popValue removes the value at the given dotted key of the event and returns it, or nil if it's not set
+func popValue(evt common.MapStr, key string) interface{} {
+	v, err := evt.GetValue(key)
+	if err != nil {
+		return nil
+	}
+	evt.Delete(key)
+	return v
+}
+
+// getString returns the string at the given dotted key of the event
+func getString(evt common.MapStr, key string) (string, bool) {
+	v, err := evt.GetValue(key)
+	if err != nil {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// pruneEmpty recursively removes the nil values and the empty objects from the event
+func pruneEmpty(m map[string]interface{}) {
+	for k, v := range m {
+		switch inner := v.(type) {
+		case nil:
+			delete(m, k)
+		case common.MapStr:
+			pruneEmpty(inner)
+			if len(inner) == 0 {
+				delete(m, k)
+			}
+		case map[string]interface{}:
+			pruneEmpty(inner)
+			if len(inner) == 0 {
+				delete(m, k)
+			}
+		}
+	}
+}
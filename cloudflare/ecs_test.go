@@ -0,0 +1,229 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestToECS(t *testing.T) {
+	tests := []struct {
+		name     string
+		evt      common.MapStr
+		expected map[string]interface{}
+		removed  []string
+	}{
+		{
+			name: "request",
+			evt: common.MapStr{
+				"@timestamp": common.Time{},
+				"type":       "cloudflare",
+				"rayId":      "3a1b2c3d4e5f6a7b",
+				"ownerId":    float64(1234),
+				"client":     common.MapStr{"ip": "203.0.113.42", "srcPort": float64(54321), "country": "ca", "asNum": float64(13335)},
+				"clientRequest": common.MapStr{
+					"httpHost":     "www.example.com",
+					"httpMethod":   "GET",
+					"httpProtocol": "HTTP/2",
+					"scheme":       "https",
+					"uri":          "/search?q=cloudflare",
+					"userAgent":    "curl/7.54.0",
+					"referer":      "https://example.com/",
+				},
+				"edge":         common.MapStr{"colo": float64(14), "pathingOp": "wl"},
+				"edgeResponse": common.MapStr{"status": float64(200), "bytes": float64(1024), "contentType": "text/html"},
+				"cache":        common.MapStr{"cacheStatus": "hit"},
+				"event":        common.MapStr{"duration": int64(25123456)},
+				"timing":       common.MapStr{"edgeDuration": 25.123},
+			},
+			expected: map[string]interface{}{
+				"@timestamp":                     common.Time{},
+				"type":                           "cloudflare",
+				"ecs.version":                    ECS_VERSION,
+				"event.kind":                     "event",
+				"event.category":                 []string{"web"},
+				"event.dataset":                  "cloudflare.requests",
+				"event.id":                       "3a1b2c3d4e5f6a7b",
+				"event.duration":                 int64(25123456),
+				"cloud.provider":                 "cloudflare",
+				"cloud.account.id":               float64(1234),
+				"cloud.availability_zone":        "14",
+				"source.ip":                      "203.0.113.42",
+				"source.port":                    float64(54321),
+				"source.as.number":               float64(13335),
+				"source.geo.country_iso_code":    "CA",
+				"url.domain":                     "www.example.com",
+				"url.scheme":                     "https",
+				"url.original":                   "/search?q=cloudflare",
+				"url.path":                       "/search",
+				"url.query":                      "q=cloudflare",
+				"url.full":                       "https://www.example.com/search?q=cloudflare",
+				"user_agent.original":            "curl/7.54.0",
+				"http.version":                   "2",
+				"http.request.method":            "GET",
+				"http.request.referrer":          "https://example.com/",
+				"http.response.status_code":      float64(200),
+				"http.response.bytes":            float64(1024),
+				"http.response.mime_type":        "text/html",
+				"cloudflare.edge.pathingOp":      "wl",
+				"cloudflare.cache.cacheStatus":   "hit",
+				"cloudflare.timing.edgeDuration": 25.123,
+			},
+			removed: []string{
+				"rayId", "client", "clientRequest", "edgeResponse", "cloudflare.rayId", "cloudflare.client",
+				"cloudflare.clientRequest", "cloudflare.edgeResponse", "cloudflare.edge.colo", "cloudflare.event",
+				"cloudflare.@timestamp", "cloudflare.type",
+			},
+		},
+		{
+			name: "enriched request",
+			evt: common.MapStr{
+				"@timestamp": common.Time{},
+				"type":       "cloudflare",
+				"rayId":      "3a1b2c3d4e5f6a7c",
+				"client": common.MapStr{
+					"ip":      "203.0.113.42",
+					"country": "ca",
+					"asNum":   float64(13335),
+					"geo": common.MapStr{
+						"cityName":       "Montreal",
+						"regionIsoCode":  "QC",
+						"countryIsoCode": "CA",
+						"location":       common.MapStr{"lat": 45.5, "lon": -73.6},
+						"asNumber":       uint(64496),
+						"asOrganization": "Example",
+					},
+				},
+				"clientRequest": common.MapStr{
+					"uri":       "/a%20b/index.html?x=1",
+					"path":      "/a b/index.html",
+					"query":     "x=1",
+					"extension": "html",
+					"userAgent": "Mozilla/5.0",
+				},
+				"user_agent": common.MapStr{"name": "Chrome", "version": "60.0", "os": common.MapStr{"name": "Windows"}},
+			},
+			expected: map[string]interface{}{
+				"event.id":                    "3a1b2c3d4e5f6a7c",
+				"source.ip":                   "203.0.113.42",
+				"source.geo.city_name":        "Montreal",
+				"source.geo.region_iso_code":  "QC",
+				"source.geo.country_iso_code": "CA",
+				"source.geo.location":         common.MapStr{"lat": 45.5, "lon": -73.6},
+				"source.as.number":            float64(13335),
+				"source.as.organization.name": "Example",
+				"url.original":                "/a%20b/index.html?x=1",
+				"url.path":                    "/a b/index.html",
+				"url.query":                   "x=1",
+				"url.extension":               "html",
+				"user_agent.original":         "Mozilla/5.0",
+				"user_agent.name":             "Chrome",
+				"user_agent.version":          "60.0",
+				"user_agent.os":               common.MapStr{"name": "Windows"},
+			},
+			removed: []string{"url.full", "user_agent.os.full", "cloudflare.client", "cloudflare.clientRequest", "cloudflare.user_agent"},
+		},
+		{
+			name: "empty values",
+			evt: common.MapStr{
+				"@timestamp":    common.Time{},
+				"type":          "cloudflare",
+				"client":        common.MapStr{"country": ""},
+				"clientRequest": common.MapStr{"uri": "/", "httpProtocol": ""},
+				"origin":        common.MapStr{"ip": nil, "responseTime": nil},
+				"edge":          common.MapStr{"waf": common.MapStr{"rule": nil}},
+			},
+			expected: map[string]interface{}{
+				"url.original": "/",
+				"url.path":     "/",
+			},
+			removed: []string{"event.id", "source", "http", "url.query", "url.full", "cloudflare"},
+		},
+	}
+
+	for _, test := range tests {
+		evt := ToECS(test.evt)
+		for key, expected := range test.expected {
+			v, err := evt.GetValue(key)
+			if err != nil {
+				t.Errorf("%s: expected %s to be set, got %v", test.name, key, evt)
+			} else if !reflect.DeepEqual(v, expected) {
+				t.Errorf("%s: expected %s to be %#v, got %#v", test.name, key, expected, v)
+			}
+		}
+		for _, key := range test.removed {
+			if v, err := evt.GetValue(key); err == nil {
+				t.Errorf("%s: expected %s to be removed, got %v", test.name, key, v)
+			}
+		}
+	}
+}
+
+func TestBuildEnrichedEventECS(t *testing.T) {
+	uaParser, err := NewUserAgentParser("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := NewLogConsumer("", "", 1, 1, 1)
+	lc.OutputSchema = "ecs"
+	lc.UserAgentParser = uaParser
+	lc.URIParser = NewURIParser(nil)
+
+	start := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC).UnixNano()
+	evt, err := lc.BuildEnrichedEvent(map[string]interface{}{
+		"RayID":                  "3a1b2c3d4e5f6a7b",
+		"EdgeStartTimestamp":     float64(start),
+		"EdgeEndTimestamp":       float64(start + 8000000),
+		"ClientIP":               "203.0.113.42",
+		"ClientCountry":          "ca",
+		"ClientRequestHost":      "www.example.com",
+		"ClientRequestMethod":    "POST",
+		"ClientRequestProtocol":  "HTTP/1.1",
+		"ClientRequestURI":       "/api/users/42?page=2",
+		"ClientRequestUserAgent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/60.0.3112.113 Safari/537.36",
+		"EdgeColoID":             float64(14),
+		"EdgeResponseStatus":     float64(404),
+		"CacheCacheStatus":       "miss",
+		"OriginIP":               "198.51.100.7",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"@timestamp":                            common.Time(time.Unix(0, start)),
+		"event.id":                              "3a1b2c3d4e5f6a7b",
+		"event.duration":                        int64(8000000),
+		"source.ip":                             "203.0.113.42",
+		"source.geo.country_iso_code":           "CA",
+		"url.domain":                            "www.example.com",
+		"url.original":                          "/api/users/42?page=2",
+		"url.path":                              "/api/users/42",
+		"url.query":                             "page=2",
+		"http.version":                          "1.1",
+		"http.request.method":                   "POST",
+		"http.response.status_code":             float64(404),
+		"cloud.availability_zone":               "14",
+		"user_agent.name":                       "Chrome",
+		"user_agent.os.name":                    "Windows",
+		"cloudflare.clientRequest.pathTemplate": "/api/users/{id}",
+		"cloudflare.origin.ip":                  "198.51.100.7",
+		"cloudflare.cache.cacheStatus":          "miss",
+		"cloudflare.sampleRate":                 float64(1),
+	}
+	for key, value := range expected {
+		if v, err := evt.GetValue(key); err != nil || !reflect.DeepEqual(v, value) {
+			t.Errorf("Expected %s to be %#v, got %#v", key, value, v)
+		}
+	}
+	for _, key := range []string{"rayId", "client", "edgeResponse", "cloudflare.clientRequest.uri", "cloudflare.clientRequest.userAgent", "cloudflare.client.ip"} {
+		if v, err := evt.GetValue(key); err == nil {
+			t.Errorf("Expected %s to be removed, got %v", key, v)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package cloudflare
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+// DownloadLogFiles downloads the logs of the time range as separate segments of at most MAX_SEGMENT_SECONDS, up to
+// TotalLogFileSegments of them in parallel, retrying the failed segments up to the given number of times. The
+// downloaded log files are returned in time order along with the segments which still failed. Unlike
+// DownloadCurrentLogFiles, the log files are left for the caller rather than processed into events.
+func (lc *LogConsumer) DownloadLogFiles(zoneTag string, timeStart int, timeEnd int, retries int) ([]string, []TimeRange) {
+
+	files := map[int]string{}
+	failed := []TimeRange{}
+	pending := SplitLongTimeRanges([]TimeRange{{Start: timeStart, End: timeEnd}}, MAX_SEGMENT_SECONDS)
+
+	for len(pending) > 0 {
+		batch := pending
+		if len(batch) > lc.TotalLogFileSegments {
+			batch = batch[:lc.TotalLogFileSegments]
+		}
+		pending = pending[len(batch):]
+		failed = append(failed, lc.downloadSegmentFiles(zoneTag, batch, retries, files)...)
+	}
+
+	starts := []int{}
+	for start := range files {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	sorted := []string{}
+	for _, start := range starts {
+		sorted = append(sorted, files[start])
+	}
+
+	return sorted, failed
+}
+
+// downloadSegmentFiles downloads the segments in parallel, retrying the failed ones up to the given number of times.
+// The downloaded log files are added to files by the start of their segment, and the segments which still failed
+// are returned.
+func (lc *LogConsumer) downloadSegmentFiles(zoneTag string, segments []TimeRange, retries int, files map[int]string) []TimeRange {
+
+	for attempt := 0; attempt <= retries && len(segments) > 0; attempt++ {
+		if attempt > 0 {
+			logp.Info("Retrying %d failed log segment(s), attempt %d of %d", len(segments), attempt, retries)
+		}
+
+		lc.DownloadLogSegments(zoneTag, segments)
+
+		// Each segment either queues its downloaded file or is marked as done when empty or failed
+		downloaded := make(chan struct{})
+		go func() {
+			lc.WaitGroup.Wait()
+			close(downloaded)
+		}()
+	collect:
+		for {
+			select {
+			case filename := <-lc.LogFilesReady:
+				lc.segmentsLock.Lock()
+				segment := lc.pendingSegments[filename]
+				delete(lc.pendingSegments, filename)
+				lc.segmentsLock.Unlock()
+				files[segment.Start] = filename
+				lc.segmentDone(segment, nil)
+				lc.WaitGroup.Done()
+			case <-downloaded:
+				break collect
+			}
+		}
+
+		_, segments = lc.SegmentResults()
+	}
+
+	return segments
+}
+
+type timestampedLine struct {
+	timestamp int64
+	line      []byte
+}
+
+type timestampedLines []timestampedLine
+
+func (t timestampedLines) Len() int           { return len(t) }
+func (t timestampedLines) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t timestampedLines) Less(i, j int) bool { return t[i].timestamp < t[j].timestamp }
+
+// WriteSortedLogFile writes the log lines of the log files to w in timestamp order, as the raw log lines or as the
+// events built by the configured stages of the LogConsumer. The log files must cover consecutive time ranges, as
+// they're sorted one at a time. The number of lines written and the number of lines which could not be processed are
+// returned.
+func (lc *LogConsumer) WriteSortedLogFile(files []string, w io.Writer, normalize bool) (int, int, error) {
+
+	written, skipped := 0, 0
+	for _, filename := range files {
+		lines, invalid, err := lc.readTimestampedLines(filename, normalize)
+		if err != nil {
+			return written, skipped, err
+		}
+		skipped += invalid
+
+		sort.Stable(timestampedLines(lines))
+		for _, l := range lines {
+			if _, err := w.Write(append(l.line, '\n')); err != nil {
+				return written, skipped, err
+			}
+			written++
+		}
+	}
+
+	return written, skipped, nil
+}
+
+// readTimestampedLines reads the lines of a log file along with their timestamp, either as is or normalized
+func (lc *LogConsumer) readTimestampedLines(filename string, normalize bool) (timestampedLines, int, error) {
+
+	fh, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer fh.Close()
+
+	reader, err := openLogReader(fh)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	lines := timestampedLines{}
+	invalid := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), MAX_LOG_LINE_SIZE)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		var l map[string]interface{}
+		if err := ffjson.Unmarshal(scanner.Bytes(), &l); err != nil {
+			logp.Err("Could not load JSON from line %d of %s: %v", lineNumber, filename, err)
+			invalid++
+			continue
+		}
+		if l, err = NestLogRecord(l); err != nil {
+			logp.Err("Could not convert line %d of %s: %v", lineNumber, filename, err)
+			invalid++
+			continue
+		}
+		ts := nanoseconds(common.MapStr(l), "timestamp")
+		if ts <= 0 {
+			logp.Err("Missing timestamp on line %d of %s", lineNumber, filename)
+			invalid++
+			continue
+		}
+
+		line := append([]byte{}, scanner.Bytes()...)
+		if normalize {
+			evt, err := lc.BuildEnrichedEvent(l)
+			if err != nil {
+				logp.Err("Could not normalize line %d of %s: %v", lineNumber, filename, err)
+				invalid++
+				continue
+			}
+			// Normalize the event the same way as the publisher, which drops the empty fields
+			if line, err = json.Marshal(common.ConvertToGenericEvent(evt)); err != nil {
+				return nil, invalid, err
+			}
+		}
+
+		lines = append(lines, timestampedLine{timestamp: ts, line: line})
+	}
+
+	return lines, invalid, scanner.Err()
+}
@@ -0,0 +1,180 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const TEST_FETCH_START = 1500000000
+
+func TestDownloadLogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The log files are downloaded to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// The second hour fails once, the third one has no logs and the fourth one always fails
+	var lock sync.Mutex
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/client/v4/zones/zone/logs/requests" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		start := r.URL.Query().Get("start")
+		lock.Lock()
+		attempts[start]++
+		attempt := attempts[start]
+		lock.Unlock()
+
+		switch start {
+		case fmt.Sprint(TEST_FETCH_START + 3600):
+			if attempt == 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		case fmt.Sprint(TEST_FETCH_START + 2*3600):
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case fmt.Sprint(TEST_FETCH_START + 3*3600):
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "{\"rayId\": \"%s\"}\n", start)
+	}))
+	defer server.Close()
+
+	lc := NewLogConsumer("user@example.com", "key", 2, 10, 1)
+	lc.cloudflareClient.apiBase = server.URL
+
+	files, failed := lc.DownloadLogFiles("zone", TEST_FETCH_START, TEST_FETCH_START+4*3600-1, 1)
+
+	expectedFiles := []string{
+		fmt.Sprintf("cloudflare_logs_%d_to_%d.txt.gz", TEST_FETCH_START, TEST_FETCH_START+3599),
+		fmt.Sprintf("cloudflare_logs_%d_to_%d.txt.gz", TEST_FETCH_START+3600, TEST_FETCH_START+2*3600-1),
+	}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Errorf("The downloaded files are %v, expected %v", files, expectedFiles)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Errorf("The log file %s wasn't downloaded: %v", f, err)
+		}
+	}
+	if expected := []TimeRange{{Start: TEST_FETCH_START + 3*3600, End: TEST_FETCH_START + 4*3600 - 1}}; !reflect.DeepEqual(failed, expected) {
+		t.Errorf("The failed segments are %v, expected %v", failed, expected)
+	}
+	if attempts[fmt.Sprint(TEST_FETCH_START+3600)] != 2 || attempts[fmt.Sprint(TEST_FETCH_START+3*3600)] != 2 {
+		t.Errorf("Expected the failed segments to be retried once, got %v", attempts)
+	}
+}
+
+// testLogLine returns a flat log line with the given Ray ID and timestamp in seconds
+func testLogLine(rayID string, ts int64) string {
+	return fmt.Sprintf(`{"RayID": "%s", "EdgeStartTimestamp": %d, "ClientIP": "203.0.113.42"}`, rayID, ts*1000000000)
+}
+
+func TestWriteSortedLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each file covers its own time range, with its lines out of order and some invalid ones
+	contents := [][]string{
+		{
+			testLogLine("b", TEST_FETCH_START+20),
+			testLogLine("a", TEST_FETCH_START+10),
+			`not json`,
+			testLogLine("c", TEST_FETCH_START+20),
+		},
+		{
+			testLogLine("e", TEST_FETCH_START+3700),
+			`{"RayID": "missing timestamp", "ClientIP": "203.0.113.42"}`,
+			testLogLine("d", TEST_FETCH_START+3600),
+		},
+	}
+	files := []string{}
+	for i, lines := range contents {
+		f := filepath.Join(dir, fmt.Sprintf("segment-%d.ndjson", i))
+		if err := ioutil.WriteFile(f, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	lc := NewLogConsumer("", "", 1, 1, 1)
+
+	buf := &bytes.Buffer{}
+	written, skipped, err := lc.WriteSortedLogFile(files, buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 5 || skipped != 2 {
+		t.Errorf("%d lines were written and %d skipped, expected 5 and 2", written, skipped)
+	}
+	// Lines with the same timestamp keep their order
+	expected := strings.Join([]string{
+		testLogLine("a", TEST_FETCH_START+10),
+		testLogLine("b", TEST_FETCH_START+20),
+		testLogLine("c", TEST_FETCH_START+20),
+		testLogLine("d", TEST_FETCH_START+3600),
+		testLogLine("e", TEST_FETCH_START+3700),
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected the lines in timestamp order:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// The normalized lines are the published events, with the configured stages applied
+	lc.Privacy = newTestPrivacyFilter(t, map[string]interface{}{"client_ip": "truncate"})
+	buf.Reset()
+	written, skipped, err = lc.WriteSortedLogFile(files, buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 5 || skipped != 2 {
+		t.Errorf("%d events were written and %d skipped, expected 5 and 2", written, skipped)
+	}
+	rayIDs := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var evt map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &evt); err != nil {
+			t.Fatal(err)
+		}
+		rayIDs = append(rayIDs, fmt.Sprint(evt["rayId"]))
+		if client, _ := evt["client"].(map[string]interface{}); client["ip"] != "203.0.113.0" {
+			t.Errorf("Expected the privacy settings to be applied, got %v", evt["client"])
+		}
+	}
+	if strings.Join(rayIDs, " ") != "a b c d e" {
+		t.Errorf("The events are in the order %v, expected a b c d e", rayIDs)
+	}
+
+	if _, _, err := lc.WriteSortedLogFile([]string{filepath.Join(dir, "missing.ndjson")}, buf, false); err == nil {
+		t.Errorf("Expected an error for a missing log file")
+	}
+}
@@ -0,0 +1,193 @@
+package cloudflare
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// fieldRulesKeptFields are the fields which are required to publish the events, or by the Elastic Common Schema, and
+// which are never removed
+var fieldRulesKeptFields = map[string]bool{
+	"@timestamp": true,
+	"type":       true,
+	"ecs":        true,
+	"event":      true,
+}
+
+// FieldRule includes, excludes and renames the fields of the events of some zones, to cut the size of the events or
+// to match existing naming conventions
+type FieldRule struct {
+	zones   map[string]bool
+	include [][]string
+	exclude [][]string
+	renames [][2]string
+}
+
+// NewFieldRule returns a new instance of a FieldRule. The zones are the names or IDs of the zones the rule applies
+// to, or all the zones when empty. The include and exclude params are dotted field paths in which * matches a single
+// level, and rename is the list of dotted paths of fields along with their new paths, applied in order.
+func NewFieldRule(params map[string]interface{}) (*FieldRule, error) {
+	r := &FieldRule{zones: map[string]bool{}}
+	for _, zone := range params["zones"].([]string) {
+		r.zones[zone] = true
+	}
+
+	var err error
+	if r.include, err = splitFieldPatterns(params["include"].([]string)); err != nil {
+		return nil, err
+	}
+	if r.exclude, err = splitFieldPatterns(params["exclude"].([]string)); err != nil {
+		return nil, err
+	}
+
+	for _, rename := range params["rename"].([][2]string) {
+		if rename[0] == "" || rename[1] == "" {
+			return nil, fmt.Errorf("Invalid rename of '%s' to '%s'", rename[0], rename[1])
+		}
+		if fieldRulesKeptFields[rename[0]] {
+			return nil, fmt.Errorf("The %s field can't be renamed", rename[0])
+		}
+		r.renames = append(r.renames, rename)
+	}
+
+	return r, nil
+}
+
+// splitFieldPatterns splits the dotted field path patterns into their levels, validating their wildcards
+func splitFieldPatterns(patterns []string) ([][]string, error) {
+	split := [][]string{}
+	for _, pattern := range patterns {
+		levels := strings.Split(pattern, ".")
+		for _, level := range levels {
+			if _, err := path.Match(level, ""); err != nil || level == "" {
+				return nil, fmt.Errorf("Invalid field pattern '%s'", pattern)
+			}
+		}
+		split = append(split, levels)
+	}
+	return split, nil
+}
+
+// AppliesTo returns true if the rule applies to the zone of the log record, given by its zoneName or zoneId
+func (r *FieldRule) AppliesTo(l map[string]interface{}) bool {
+	if len(r.zones) == 0 {
+		return true
+	}
+	if name, ok := l["zoneName"].(string); ok && r.zones[name] {
+		return true
+	}
+	switch id := l["zoneId"].(type) {
+	case float64:
+		return r.zones[strconv.FormatFloat(id, 'f', -1, 64)]
+	case int64:
+		return r.zones[strconv.FormatInt(id, 10)]
+	case string:
+		return r.zones[id]
+	}
+	return false
+}
+
+// Apply keeps the included fields of the event, then removes the excluded ones and renames the remaining ones. The
+// fieldRulesKeptFields are always kept. As the rules are applied once the event is converted to the output schema,
+// their paths are the ECS ones with the ecs schema.
+func (r *FieldRule) Apply(evt common.MapStr) {
+	if len(r.include) > 0 {
+		filterFields(evt, nil, r.include, true)
+	}
+	if len(r.exclude) > 0 {
+		filterFields(evt, nil, r.exclude, false)
+	}
+	for _, rename := range r.renames {
+		if v := popValue(evt, rename[0]); v != nil {
+			removeEmptyParents(evt, rename[0])
+			evt.Put(rename[1], v)
+		}
+	}
+}
+
+// removeEmptyParents removes the objects of the dotted key which were left empty once its field was removed
+func removeEmptyParents(evt common.MapStr, key string) {
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key, ".") {
+		key = key[:i]
+		v, err := evt.GetValue(key)
+		if err != nil {
+			return
+		}
+		switch inner := v.(type) {
+		case common.MapStr:
+			if len(inner) > 0 {
+				return
+			}
+		case map[string]interface{}:
+			if len(inner) > 0 {
+				return
+			}
+		default:
+			return
+		}
+		evt.Delete(key)
+	}
+}
+
+// filterFields keeps the fields of the object matching one of the patterns if include is set, and removes them
+// otherwise. A pattern matching an object matches all of its fields.
+func filterFields(m map[string]interface{}, parent []string, patterns [][]string, include bool) {
+	for k, v := range m {
+		if parent == nil && fieldRulesKeptFields[k] {
+			continue
+		}
+		levels := append(append([]string{}, parent...), k)
+
+		if matchesFieldPatterns(patterns, levels, false) {
+			if !include {
+				delete(m, k)
+			}
+			continue
+		}
+
+		var inner map[string]interface{}
+		switch v := v.(type) {
+		case common.MapStr:
+			inner = v
+		case map[string]interface{}:
+			inner = v
+		}
+		if inner == nil || !matchesFieldPatterns(patterns, levels, true) {
+			if include {
+				delete(m, k)
+			}
+			continue
+		}
+
+		filterFields(inner, levels, patterns, include)
+		if len(inner) == 0 {
+			delete(m, k)
+		}
+	}
+}
+
+// matchesFieldPatterns returns true if one of the patterns matches the field path, or one of its descendants when
+// descendants is set
+func matchesFieldPatterns(patterns [][]string, levels []string, descendants bool) bool {
+	for _, pattern := range patterns {
+		if len(pattern) < len(levels) || (!descendants && len(pattern) != len(levels)) ||
+			(descendants && len(pattern) == len(levels)) {
+			continue
+		}
+		matches := true
+		for i, level := range levels {
+			if ok, _ := path.Match(pattern[i], level); !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// testFieldRuleParams returns the params of a FieldRule which changes nothing, overridden by the given ones
+func testFieldRuleParams(params map[string]interface{}) map[string]interface{} {
+	p := map[string]interface{}{
+		"zones":   []string{},
+		"include": []string{},
+		"exclude": []string{},
+		"rename":  [][2]string{},
+	}
+	for k, v := range params {
+		p[k] = v
+	}
+	return p
+}
+
+func newTestEvent() common.MapStr {
+	return common.MapStr{
+		"@timestamp": common.Time{},
+		"type":       "cloudflare",
+		"rayId":      "3a1b2c3d4e5f6a7b",
+		"client":     common.MapStr{"ip": "203.0.113.42", "country": "ca"},
+		"clientRequest": common.MapStr{
+			"uri":     "/index.html",
+			"headers": []interface{}{header("accept", "*/*")},
+		},
+		"edge": common.MapStr{
+			"waf":       common.MapStr{"profile": "high", "action": "block"},
+			"rateLimit": common.MapStr{"profile": "default", "action": "simulate"},
+			"colo":      "YUL",
+		},
+		"edgeResponse": common.MapStr{"status": 200, "headers": []interface{}{header("server", "cloudflare")}},
+	}
+}
+
+func TestNewFieldRuleValidation(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"include": []string{"client..ip"}},
+		{"include": []string{""}},
+		{"exclude": []string{"edge.[waf"}},
+		{"rename": [][2]string{{"client.ip", ""}}},
+		{"rename": [][2]string{{"", "ip"}}},
+		{"rename": [][2]string{{"@timestamp", "timestamp"}}},
+		{"rename": [][2]string{{"type", "kind"}}},
+		{"rename": [][2]string{{"event", "cloudflare.event"}}},
+	}
+
+	for _, params := range tests {
+		if _, err := NewFieldRule(testFieldRuleParams(params)); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestFieldRuleApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		expected common.MapStr
+	}{
+		{
+			name:   "include",
+			params: map[string]interface{}{"include": []string{"rayId", "client.ip", "edge.*.profile", "edgeResponse"}},
+			expected: common.MapStr{
+				"@timestamp": common.Time{},
+				"type":       "cloudflare",
+				"rayId":      "3a1b2c3d4e5f6a7b",
+				"client":     common.MapStr{"ip": "203.0.113.42"},
+				"edge": common.MapStr{
+					"waf":       common.MapStr{"profile": "high"},
+					"rateLimit": common.MapStr{"profile": "default"},
+				},
+				"edgeResponse": common.MapStr{"status": 200, "headers": []interface{}{header("server", "cloudflare")}},
+			},
+		},
+		{
+			name:   "exclude",
+			params: map[string]interface{}{"exclude": []string{"*.headers", "edge.waf", "edge.rateLimit.*", "client"}},
+			expected: common.MapStr{
+				"@timestamp":    common.Time{},
+				"type":          "cloudflare",
+				"rayId":         "3a1b2c3d4e5f6a7b",
+				"clientRequest": common.MapStr{"uri": "/index.html"},
+				"edge":          common.MapStr{"colo": "YUL"},
+				"edgeResponse":  common.MapStr{"status": 200},
+			},
+		},
+		{
+			name: "include, exclude and rename",
+			params: map[string]interface{}{
+				"include": []string{"client", "clientRequest.uri", "edge.waf"},
+				"exclude": []string{"client.country"},
+				"rename":  [][2]string{{"clientRequest.uri", "request.uri"}, {"edge.waf.action", "wafAction"}, {"missing", "other"}},
+			},
+			expected: common.MapStr{
+				"@timestamp": common.Time{},
+				"type":       "cloudflare",
+				"client":     common.MapStr{"ip": "203.0.113.42"},
+				"request":    common.MapStr{"uri": "/index.html"},
+				"edge":       common.MapStr{"waf": common.MapStr{"profile": "high"}},
+				"wafAction":  "block",
+			},
+		},
+		{
+			name:   "kept fields",
+			params: map[string]interface{}{"include": []string{"rayId"}, "exclude": []string{"*", "@timestamp", "type"}},
+			expected: common.MapStr{
+				"@timestamp": common.Time{},
+				"type":       "cloudflare",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r, err := NewFieldRule(testFieldRuleParams(test.params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		evt := newTestEvent()
+		r.Apply(evt)
+		if !reflect.DeepEqual(evt, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, evt)
+		}
+	}
+}
+
+func TestFieldRuleApplyECS(t *testing.T) {
+	r, err := NewFieldRule(testFieldRuleParams(map[string]interface{}{
+		"include": []string{"source.ip", "cloudflare.edge.*.profile"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := ToECS(newTestEvent())
+	r.Apply(evt)
+
+	for _, key := range []string{"@timestamp", "type", "ecs.version", "event.kind", "event.id", "source.ip", "cloudflare.edge.waf.profile"} {
+		if _, err := evt.GetValue(key); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", key, evt)
+		}
+	}
+	for _, key := range []string{"url.original", "cloud", "cloudflare.edge.waf.action", "cloudflare.client"} {
+		if _, err := evt.GetValue(key); err == nil {
+			t.Errorf("Expected %s to be removed", key)
+		}
+	}
+}
+
+func TestFieldRuleAppliesTo(t *testing.T) {
+	r, err := NewFieldRule(testFieldRuleParams(map[string]interface{}{"zones": []string{"example.com", "1234"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		record   map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"zoneName": "example.com"}, true},
+		{map[string]interface{}{"zoneName": "other.com"}, false},
+		{map[string]interface{}{"zoneId": float64(1234)}, true},
+		{map[string]interface{}{"zoneId": int64(1234)}, true},
+		{map[string]interface{}{"zoneId": "1234"}, true},
+		{map[string]interface{}{"zoneId": float64(4321)}, false},
+		{map[string]interface{}{}, false},
+	}
+
+	for _, test := range tests {
+		if applies := r.AppliesTo(test.record); applies != test.expected {
+			t.Errorf("Expected AppliesTo(%v) to be %v", test.record, test.expected)
+		}
+	}
+
+	all, err := NewFieldRule(testFieldRuleParams(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !all.AppliesTo(map[string]interface{}{}) {
+		t.Errorf("Expected a rule without zones to apply to all the zones")
+	}
+}
@@ -0,0 +1,111 @@
+package cloudflare
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// fieldDefinition is an entry of the fields.yml file, either a section with its key or a field within a section
+type fieldDefinition struct {
+	Key    string            `config:"key"`
+	Name   string            `config:"name"`
+	Type   string            `config:"type"`
+	Fields []fieldDefinition `config:"fields"`
+}
+
+// FieldsReport is the result of checking the log fields against the ones available from the API and the mapped ones
+type FieldsReport struct {
+	Unknown  []string // Configured fields which aren't available from the API
+	Unmapped []string // Configured fields, or all the available ones if none are configured, which aren't in fields.yml
+}
+
+// LoadFieldsYml returns the dotted names of all the fields defined in the given fields.yml file
+func LoadFieldsYml(path string) ([]string, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file is a list of sections, which can only be loaded once nested under a key
+	nested := "sections:\n"
+	for _, line := range strings.Split(string(content), "\n") {
+		nested += "  " + line + "\n"
+	}
+
+	cfg, err := common.NewConfigWithYAML([]byte(nested), path)
+	if err != nil {
+		return nil, err
+	}
+	doc := struct {
+		Sections []fieldDefinition `config:"sections"`
+	}{}
+	if err := cfg.Unpack(&doc); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, section := range doc.Sections {
+		names = appendFieldNames(names, "", section.Fields)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func appendFieldNames(names []string, prefix string, fields []fieldDefinition) []string {
+	for _, f := range fields {
+		name := prefix + f.Name
+		if f.Type == "group" {
+			names = appendFieldNames(names, name+".", f.Fields)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// normalizeFieldName allows matching the Logpull field names, such as ClientRequestHost, with the mapped field
+// names, such as clientRequest.host
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.NewReplacer(".", "", "_", "").Replace(name))
+}
+
+// CheckFields compares the configured log fields with the fields available from the API and the fields mapped in
+// fields.yml
+func CheckFields(configured []string, available map[string]string, mapped []string) FieldsReport {
+
+	report := FieldsReport{Unknown: []string{}, Unmapped: []string{}}
+
+	isMapped := map[string]bool{}
+	for _, name := range mapped {
+		isMapped[normalizeFieldName(name)] = true
+	}
+
+	fields := configured
+	if len(fields) == 0 {
+		for name := range available {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+
+	for _, name := range fields {
+		if _, ok := available[name]; !ok {
+			report.Unknown = append(report.Unknown, name)
+		}
+		// The flat fields are published under their nested name
+		mappedName := name
+		if path, ok := LOGPULL_FIELDS[name]; ok {
+			mappedName = path
+		}
+		if mapped != nil && !isMapped[normalizeFieldName(mappedName)] {
+			report.Unmapped = append(report.Unmapped, name)
+		}
+	}
+
+	return report
+}
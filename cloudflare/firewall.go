@@ -0,0 +1,154 @@
+package cloudflare
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	FIREWALL_EVENTS_URI       = "/client/v4/zones/%s/security/events"
+	FIREWALL_EVENTS_MAX_LIMIT = 1000 // Maximum number of events per page allowed by the API
+)
+
+// FirewallEvent is a firewall/security event as returned by the Cloudflare firewall events API
+type FirewallEvent struct {
+	RayID          string          `json:"ray_id"`
+	Kind           string          `json:"kind"`
+	Source         string          `json:"source"`
+	Action         string          `json:"action"`
+	RuleID         string          `json:"rule_id"`
+	RuleMessage    string          `json:"rule_message"`
+	IP             string          `json:"ip"`
+	IPClass        string          `json:"ip_class"`
+	Country        string          `json:"country"`
+	ASN            int             `json:"asn"`
+	ASNDescription string          `json:"asn_description"`
+	Colo           string          `json:"colo"`
+	Host           string          `json:"host"`
+	Method         string          `json:"method"`
+	Protocol       string          `json:"proto"`
+	Scheme         string          `json:"scheme"`
+	UserAgent      string          `json:"ua"`
+	URI            string          `json:"uri"`
+	OccurredAt     string          `json:"occurred_at"`
+	MatchIndex     int             `json:"match_index"`
+	Matches        []FirewallMatch `json:"matches"`
+}
+
+// FirewallMatch is one of the rules which matched the request of a firewall event
+type FirewallMatch struct {
+	RuleID string `json:"rule_id"`
+	Source string `json:"source"`
+	Action string `json:"action"`
+}
+
+type firewallEventsResponse struct {
+	Success bool            `json:"success"`
+	Errors  []apiError      `json:"errors"`
+	Result  []FirewallEvent `json:"result"`
+	Info    struct {
+		Cursors struct {
+			After string `json:"after"`
+		} `json:"cursors"`
+	} `json:"result_info"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// GetFirewallEvents returns a page of the firewall events which occurred within the inclusive range of unix timestamps,
+// along with the cursor of the next page which is empty once the last page is reached
+func (c *CloudflareClient) GetFirewallEvents(zoneTag string, r TimeRange, cursor string, limit int) ([]FirewallEvent, string, error) {
+
+	if limit <= 0 || limit > FIREWALL_EVENTS_MAX_LIMIT {
+		limit = FIREWALL_EVENTS_MAX_LIMIT
+	}
+
+	qsa := url.Values{}
+	qsa.Set("since", time.Unix(int64(r.Start), 0).UTC().Format(time.RFC3339))
+	// The until parameter is exclusive
+	qsa.Set("until", time.Unix(int64(r.End+1), 0).UTC().Format(time.RFC3339))
+	qsa.Set("limit", fmt.Sprintf("%d", limit))
+	if cursor != "" {
+		qsa.Set("cursor", cursor)
+	}
+
+	resp := firewallEventsResponse{}
+	if err := c.getJSON(fmt.Sprintf(FIREWALL_EVENTS_URI, zoneTag), qsa, &resp); err != nil {
+		return nil, "", err
+	}
+	if !resp.Success {
+		return nil, "", fmt.Errorf("Firewall events request failed: %v", resp.Errors)
+	}
+
+	// The API keeps returning the cursor of the last page, which then has no events
+	next := resp.Info.Cursors.After
+	if len(resp.Result) < limit {
+		next = ""
+	}
+
+	return resp.Result, next, nil
+}
+
+// BuildFirewallMapStr builds the event to be published for a firewall event. The client and request fields use the
+// same names as the request log events, while the fields specific to the firewall are under the firewall object.
+func BuildFirewallMapStr(fe FirewallEvent) (common.MapStr, error) {
+
+	ts, err := time.Parse(time.RFC3339Nano, fe.OccurredAt)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid occurred_at timestamp '%s': %v", fe.OccurredAt, err)
+	}
+
+	firewall := common.MapStr{
+		"kind":   fe.Kind,
+		"source": fe.Source,
+		"action": fe.Action,
+		"ruleId": fe.RuleID,
+		"colo":   fe.Colo,
+	}
+	if fe.RuleMessage != "" {
+		firewall["ruleMessage"] = fe.RuleMessage
+	}
+	if len(fe.Matches) > 0 {
+		matches := []common.MapStr{}
+		for _, m := range fe.Matches {
+			matches = append(matches, common.MapStr{"ruleId": m.RuleID, "source": m.Source, "action": m.Action})
+		}
+		firewall["matches"] = matches
+		firewall["matchIndex"] = fe.MatchIndex
+	}
+
+	client := common.MapStr{
+		"ipClass": fe.IPClass,
+		"country": fe.Country,
+	}
+	// Empty strings are omitted as they can't be indexed as an ip field
+	if fe.IP != "" {
+		client["ip"] = fe.IP
+	}
+	if fe.ASN != 0 {
+		client["asNum"] = fe.ASN
+		client["asDescription"] = fe.ASNDescription
+	}
+
+	return common.MapStr{
+		"@timestamp": common.Time(ts),
+		"type":       "cloudflare_firewall",
+		"rayId":      fe.RayID,
+		"firewall":   firewall,
+		"client":     client,
+		"clientRequest": common.MapStr{
+			"httpHost":     fe.Host,
+			"httpMethod":   fe.Method,
+			"httpProtocol": fe.Protocol,
+			"scheme":       fe.Scheme,
+			"uri":          fe.URI,
+			"userAgent":    fe.UserAgent,
+		},
+	}, nil
+}
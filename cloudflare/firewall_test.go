@@ -0,0 +1,121 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestGetFirewallEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/client/v4/zones/zone/security/events" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("since") != "2017-07-14T02:40:00Z" || q.Get("until") != "2017-07-14T02:45:00Z" || q.Get("limit") != "2" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		// The first page is full, the second one isn't but still has a cursor
+		switch q.Get("cursor") {
+		case "":
+			fmt.Fprint(w, `{"success": true, "result": [{"ray_id": "a"}, {"ray_id": "b"}], "result_info": {"cursors": {"after": "page2"}}}`)
+		case "page2":
+			fmt.Fprint(w, `{"success": true, "result": [{"ray_id": "c"}], "result_info": {"cursors": {"after": "page3"}}}`)
+		default:
+			t.Errorf("Unexpected cursor %s", q.Get("cursor"))
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(map[string]interface{}{"api_key": "key", "email": "user@example.com", "api_base": server.URL})
+	r := TimeRange{Start: 1500000000, End: 1500000299}
+
+	events, next, err := c.GetFirewallEvents("zone", r, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].RayID != "a" || next != "page2" {
+		t.Errorf("Unexpected first page %v with cursor %s", events, next)
+	}
+
+	events, next, err = c.GetFirewallEvents("zone", r, next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].RayID != "c" || next != "" {
+		t.Errorf("Unexpected last page %v with cursor %s", events, next)
+	}
+}
+
+func TestGetFirewallEventsErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+	}{
+		{200, `{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}]}`},
+		{403, `{"success": false}`},
+		{200, `not json`},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit := r.URL.Query().Get("limit"); limit != "1000" {
+				t.Errorf("Expected the limit to be capped at 1000, got %s", limit)
+			}
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+
+		c := NewClient(map[string]interface{}{"api_key": "key", "email": "user@example.com", "api_base": server.URL})
+		if _, _, err := c.GetFirewallEvents("zone", TimeRange{Start: 1500000000, End: 1500000299}, "", 5000); err == nil {
+			t.Errorf("Expected an error for %d %s", test.status, test.body)
+		}
+		server.Close()
+	}
+}
+
+func TestBuildFirewallMapStr(t *testing.T) {
+	evt, err := BuildFirewallMapStr(FirewallEvent{
+		RayID:      "3a1b2c3d4e5f6a7b",
+		Action:     "block",
+		IP:         "203.0.113.42",
+		Country:    "CA",
+		Host:       "www.example.com",
+		URI:        "/login",
+		OccurredAt: "2017-07-14T02:40:00.5Z",
+		Matches:    []FirewallMatch{{RuleID: "rule", Source: "firewallrules", Action: "block"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"@timestamp":             common.Time(time.Date(2017, 7, 14, 2, 40, 0, 500000000, time.UTC)),
+		"type":                   "cloudflare_firewall",
+		"rayId":                  "3a1b2c3d4e5f6a7b",
+		"firewall.action":        "block",
+		"client.ip":              "203.0.113.42",
+		"client.country":         "CA",
+		"clientRequest.httpHost": "www.example.com",
+		"clientRequest.uri":      "/login",
+	}
+	for key, value := range expected {
+		if v, err := evt.GetValue(key); err != nil || v != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, v)
+		}
+	}
+	if _, err := evt.GetValue("client.asNum"); err == nil {
+		t.Errorf("Expected no client.asNum without an ASN")
+	}
+
+	if _, err := BuildFirewallMapStr(FirewallEvent{RayID: "a", OccurredAt: "yesterday"}); err == nil {
+		t.Errorf("Expected an error for an invalid occurred_at")
+	}
+}
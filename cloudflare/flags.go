@@ -0,0 +1,65 @@
+package cloudflare
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// FlagField describes a bitmask field of the request logs and the names of its bits, starting with the lowest one.
+// Bits without a name, or with an empty one, are published as bit<N>.
+type FlagField struct {
+	Field  string
+	Target string
+	Bits   []string
+}
+
+// FLAG_FIELDS lists the bitmask fields which are decoded into a list of the names of their set bits. Cloudflare only
+// documents the meaning of some of the bits, the names of the others can be added here once they're known.
+var FLAG_FIELDS = []FlagField{
+	{Field: "flags", Target: "flagNames"},
+	{Field: "client.sslFlags", Target: "client.sslFlagNames"},
+	{Field: "clientRequest.flags", Target: "clientRequest.flagNames"},
+	{Field: "edge.enabledFlags", Target: "edge.enabledFlagNames"},
+	{Field: "edge.usedFlags", Target: "edge.usedFlagNames"},
+	{Field: "edge.waf.flags", Target: "edge.waf.flagNames", Bits: []string{"simulate"}},
+	{Field: "originResponse.flags", Target: "originResponse.flagNames"},
+}
+
+// DecodeFlags adds the names of the set bits of each of the FLAG_FIELDS present in the event, keeping the raw values
+func DecodeFlags(evt common.MapStr) {
+	for _, f := range FLAG_FIELDS {
+		v, err := evt.GetValue(f.Field)
+		if err != nil {
+			continue
+		}
+		var mask uint64
+		switch n := v.(type) {
+		case float64:
+			mask = uint64(n)
+		case int64:
+			mask = uint64(n)
+		case int:
+			mask = uint64(n)
+		default:
+			continue
+		}
+		evt.Put(f.Target, f.Names(mask))
+	}
+}
+
+// Names returns the names of the bits set in the given mask
+func (f FlagField) Names(mask uint64) []string {
+	names := []string{}
+	for bit := uint(0); mask>>bit != 0; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+		if int(bit) < len(f.Bits) && f.Bits[bit] != "" {
+			names = append(names, f.Bits[bit])
+		} else {
+			names = append(names, fmt.Sprintf("bit%d", bit))
+		}
+	}
+	return names
+}
@@ -0,0 +1,56 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestFlagFieldNames(t *testing.T) {
+	f := FlagField{Field: "edge.waf.flags", Target: "edge.waf.flagNames", Bits: []string{"simulate", "", "third"}}
+
+	tests := []struct {
+		mask     uint64
+		expected []string
+	}{
+		{0, []string{}},
+		{1, []string{"simulate"}},
+		{2, []string{"bit1"}},
+		{7, []string{"simulate", "bit1", "third"}},
+		{1 << 10, []string{"bit10"}},
+		{1 << 63, []string{"bit63"}},
+		{1<<63 | 1, []string{"simulate", "bit63"}},
+		{^uint64(0) &^ (1<<62 - 1), []string{"bit62", "bit63"}},
+	}
+
+	for _, test := range tests {
+		if names := f.Names(test.mask); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Names of %#x are %v, expected %v", test.mask, names, test.expected)
+		}
+	}
+}
+
+func TestDecodeFlags(t *testing.T) {
+	evt := common.MapStr{
+		"flags": float64(5),
+		"edge": common.MapStr{
+			"waf":          common.MapStr{"flags": int64(1)},
+			"enabledFlags": "not a number",
+		},
+	}
+	DecodeFlags(evt)
+
+	if names, _ := evt.GetValue("flagNames"); !reflect.DeepEqual(names, []string{"bit0", "bit2"}) {
+		t.Errorf("flagNames is %v", names)
+	}
+	if names, _ := evt.GetValue("edge.waf.flagNames"); !reflect.DeepEqual(names, []string{"simulate"}) {
+		t.Errorf("edge.waf.flagNames is %v", names)
+	}
+	if _, err := evt.GetValue("edge.enabledFlagNames"); err == nil {
+		t.Error("The invalid bitmask was decoded")
+	}
+}
@@ -0,0 +1,209 @@
+package cloudflare
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const GEOIP_RELOAD_CHECK_INTERVAL = 60 * time.Second // How often the databases are checked for changes
+
+// geoIPCity is the part of a GeoIP2 or GeoLite2 City record which is published
+type geoIPCity struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	Subdivisions []struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+}
+
+// geoIPASN is a GeoIP2 or GeoLite2 ASN record
+type geoIPASN struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// mmdbFile is a MaxMind database which is reopened when the file changes
+type mmdbFile struct {
+	path      string
+	reader    *maxminddb.Reader
+	modTime   time.Time
+	lastCheck time.Time
+	mutex     sync.RWMutex
+}
+
+// openMMDBFile opens the MaxMind database at the given path
+func openMMDBFile(path string) (*mmdbFile, error) {
+	f := &mmdbFile{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the database, replacing the currently opened one
+func (f *mmdbFile) open() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.Open(f.path)
+	if err != nil {
+		return err
+	}
+	if f.reader != nil {
+		f.reader.Close()
+	}
+	f.reader = reader
+	f.modTime = info.ModTime()
+	f.lastCheck = time.Now()
+	return nil
+}
+
+// reloadIfChanged reopens the database if the file was modified since it was opened. The file is only checked once
+// every GEOIP_RELOAD_CHECK_INTERVAL.
+func (f *mmdbFile) reloadIfChanged() {
+	f.mutex.RLock()
+	due := time.Since(f.lastCheck) >= GEOIP_RELOAD_CHECK_INTERVAL
+	f.mutex.RUnlock()
+	if !due {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if time.Since(f.lastCheck) < GEOIP_RELOAD_CHECK_INTERVAL {
+		return
+	}
+	f.lastCheck = time.Now()
+
+	info, err := os.Stat(f.path)
+	if err != nil || info.ModTime().Equal(f.modTime) {
+		return
+	}
+	if err := f.open(); err != nil {
+		logp.Err("Could not reload the GeoIP database %s: %v", f.path, err)
+		return
+	}
+	logp.Info("Reloaded the GeoIP database %s", f.path)
+}
+
+// lookup decodes the record of the given IP into result, returning false if there's none
+func (f *mmdbFile) lookup(ip net.IP, result interface{}) bool {
+	f.reloadIfChanged()
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	if err := f.reader.Lookup(ip, result); err != nil {
+		logp.Debug("geoip", "Could not look up %s in %s: %v", ip, f.path, err)
+		return false
+	}
+	return true
+}
+
+// GeoIPEnricher adds the location and the AS organization of the client and origin IPs to the events, using local
+// MaxMind City and ASN databases
+type GeoIPEnricher struct {
+	city *mmdbFile
+	asn  *mmdbFile
+}
+
+// NewGeoIPEnricher returns a new instance of a GeoIPEnricher using the City and ASN databases at the given paths,
+// either of which can be empty
+func NewGeoIPEnricher(cityDatabase string, asnDatabase string) (*GeoIPEnricher, error) {
+	g := &GeoIPEnricher{}
+	var err error
+	if cityDatabase != "" {
+		if g.city, err = openMMDBFile(cityDatabase); err != nil {
+			return nil, err
+		}
+	}
+	if asnDatabase != "" {
+		if g.asn, err = openMMDBFile(asnDatabase); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Enrich adds the client.geo and origin.geo objects to the event, for the IPs found in the databases
+func (g *GeoIPEnricher) Enrich(evt common.MapStr) {
+	for _, prefix := range []string{"client", "origin"} {
+		v, err := evt.GetValue(prefix + ".ip")
+		if err != nil {
+			continue
+		}
+		s, _ := v.(string)
+		ip := net.ParseIP(s)
+		if ip == nil {
+			continue
+		}
+		if geo := g.lookup(ip); len(geo) > 0 {
+			evt.Put(prefix+".geo", geo)
+		}
+	}
+}
+
+// lookup returns the geo object of the given IP
+func (g *GeoIPEnricher) lookup(ip net.IP) common.MapStr {
+	geo := common.MapStr{}
+
+	var city geoIPCity
+	if g.city != nil && g.city.lookup(ip, &city) {
+		if name := city.City.Names["en"]; name != "" {
+			geo["cityName"] = name
+		}
+		if len(city.Subdivisions) > 0 {
+			if name := city.Subdivisions[0].Names["en"]; name != "" {
+				geo["regionName"] = name
+			}
+			if city.Subdivisions[0].IsoCode != "" {
+				geo["regionIsoCode"] = city.Country.IsoCode + "-" + city.Subdivisions[0].IsoCode
+			}
+		}
+		if city.Country.IsoCode != "" {
+			geo["countryIsoCode"] = city.Country.IsoCode
+		}
+		if name := city.Country.Names["en"]; name != "" {
+			geo["countryName"] = name
+		}
+		if name := city.Continent.Names["en"]; name != "" {
+			geo["continentName"] = name
+		}
+		if city.Location.Latitude != 0 || city.Location.Longitude != 0 {
+			geo["location"] = common.MapStr{
+				"lat": city.Location.Latitude,
+				"lon": city.Location.Longitude,
+			}
+		}
+	}
+
+	var asn geoIPASN
+	if g.asn != nil && g.asn.lookup(ip, &asn) {
+		if asn.Number != 0 {
+			geo["asNumber"] = asn.Number
+		}
+		if asn.Organization != "" {
+			geo["asOrganization"] = asn.Organization
+		}
+	}
+
+	return geo
+}
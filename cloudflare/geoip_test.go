@@ -0,0 +1,143 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// The test databases only contain a record for 1.2.3.0/24
+const (
+	TEST_CITY_DATABASE = "testdata/GeoLite2-City-Test.mmdb"
+	TEST_ASN_DATABASE  = "testdata/GeoLite2-ASN-Test.mmdb"
+)
+
+func TestGeoIPEnricherEnrich(t *testing.T) {
+	g, err := NewGeoIPEnricher(TEST_CITY_DATABASE, TEST_ASN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := common.MapStr{
+		"client": common.MapStr{"ip": "1.2.3.4"},
+		"origin": common.MapStr{"ip": "5.6.7.8"},
+	}
+	g.Enrich(evt)
+
+	expected := common.MapStr{
+		"cityName":       "Montreal",
+		"regionName":     "Quebec",
+		"regionIsoCode":  "CA-QC",
+		"countryIsoCode": "CA",
+		"countryName":    "Canada",
+		"continentName":  "North America",
+		"location":       common.MapStr{"lat": 45.5, "lon": -73.6},
+		"asNumber":       uint(13335),
+		"asOrganization": "Cloudflare, Inc.",
+	}
+	geo, err := evt.GetValue("client.geo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(geo, expected) {
+		t.Errorf("Expected client.geo %v, got %v", expected, geo)
+	}
+	if _, err := evt.GetValue("origin.geo"); err == nil {
+		t.Errorf("Expected no origin.geo for an IP missing from the databases")
+	}
+}
+
+func TestGeoIPEnricherSingleDatabase(t *testing.T) {
+	g, err := NewGeoIPEnricher("", TEST_ASN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := common.MapStr{"client": common.MapStr{"ip": "1.2.3.4"}}
+	g.Enrich(evt)
+
+	expected := common.MapStr{"asNumber": uint(13335), "asOrganization": "Cloudflare, Inc."}
+	geo, _ := evt.GetValue("client.geo")
+	if !reflect.DeepEqual(geo, expected) {
+		t.Errorf("Expected client.geo %v, got %v", expected, geo)
+	}
+}
+
+func TestGeoIPEnricherSkipsInvalidIPs(t *testing.T) {
+	g, err := NewGeoIPEnricher(TEST_CITY_DATABASE, TEST_ASN_DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, evt := range []common.MapStr{
+		{},
+		{"client": common.MapStr{"ip": "not an ip"}},
+		{"client": common.MapStr{"ip": 1234}},
+	} {
+		g.Enrich(evt)
+		if _, err := evt.GetValue("client.geo"); err == nil {
+			t.Errorf("Expected no client.geo for %v", evt)
+		}
+	}
+}
+
+func TestNewGeoIPEnricherMissingDatabase(t *testing.T) {
+	if _, err := NewGeoIPEnricher("testdata/missing.mmdb", ""); err == nil {
+		t.Errorf("Expected an error for a missing database")
+	}
+}
+
+func TestMMDBFileReloadsChangedDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "city.mmdb")
+	copyFile(t, TEST_CITY_DATABASE, path)
+	g, err := NewGeoIPEnricher(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if geo := g.lookup([]byte{1, 2, 3, 4}); geo["cityName"] != "Montreal" {
+		t.Fatalf("Expected Montreal, got %v", geo)
+	}
+
+	// Replace the database with one without city names, the way updaters do, and move its modification time forward
+	copyFile(t, TEST_ASN_DATABASE, path+".new")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path+".new", later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".new", path); err != nil {
+		t.Fatal(err)
+	}
+
+	if geo := g.lookup([]byte{1, 2, 3, 4}); geo["cityName"] != "Montreal" {
+		t.Errorf("Expected the database not to be checked before GEOIP_RELOAD_CHECK_INTERVAL, got %v", geo)
+	}
+
+	g.city.lastCheck = time.Now().Add(-GEOIP_RELOAD_CHECK_INTERVAL)
+	if geo := g.lookup([]byte{1, 2, 3, 4}); geo["cityName"] != nil {
+		t.Errorf("Expected the changed database to be reloaded, got %v", geo)
+	}
+}
+
+func copyFile(t *testing.T, src string, dst string) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
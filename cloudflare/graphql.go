@@ -0,0 +1,133 @@
+package cloudflare
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	GRAPHQL_URI = "/client/v4/graphql"
+)
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLResponse struct {
+	Data struct {
+		Viewer struct {
+			Zones []map[string]interface{} `json:"zones"`
+		} `json:"viewer"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// GraphQLRow is a group row of one of the datasets returned by a GraphQL Analytics API query
+type GraphQLRow struct {
+	Dataset string
+	Fields  map[string]interface{}
+}
+
+// QueryGraphQL runs a zone query against the GraphQL Analytics API, with the zoneTag, since, until and limit variables
+// set, and returns the rows of all the datasets of the viewer zones. The time range goes from since (inclusive) to
+// until (exclusive).
+func (c *CloudflareClient) QueryGraphQL(query string, zoneTag string, since time.Time, until time.Time, limit int) ([]GraphQLRow, error) {
+
+	req := graphQLRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"zoneTag": zoneTag,
+			"since":   since.UTC().Format(time.RFC3339),
+			"until":   until.UTC().Format(time.RFC3339),
+			"limit":   limit,
+		},
+	}
+
+	resp := graphQLResponse{}
+	if err := c.postJSON(GRAPHQL_URI, req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Errors) > 0 {
+		messages := []string{}
+		for _, e := range resp.Errors {
+			messages = append(messages, e.Message)
+		}
+		return nil, fmt.Errorf("GraphQL query failed: %s", strings.Join(messages, "; "))
+	}
+
+	rows := []GraphQLRow{}
+	for _, zone := range resp.Data.Viewer.Zones {
+		for dataset, value := range zone {
+			items, ok := value.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, item := range items {
+				if fields, ok := item.(map[string]interface{}); ok {
+					rows = append(rows, GraphQLRow{Dataset: dataset, Fields: fields})
+				}
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// rowTime returns the time dimension of the group row, such as datetimeMinute or date, if there is one
+func (r GraphQLRow) rowTime() (time.Time, bool) {
+
+	dimensions, ok := r.Fields["dimensions"].(map[string]interface{})
+	if !ok {
+		return time.Time{}, false
+	}
+
+	names := []string{}
+	for name := range dimensions {
+		if strings.HasPrefix(name, "datetime") || name == "date" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, _ := dimensions[name].(string)
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, true
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// BuildGraphQLMapStr builds the event to be published for a group row of a GraphQL query. The event timestamp is the
+// time dimension of the row, or the start of the queried window if the row has none.
+func BuildGraphQLMapStr(queryName string, zoneTag string, since time.Time, until time.Time, row GraphQLRow) common.MapStr {
+
+	ts, ok := row.rowTime()
+	if !ok {
+		ts = since
+	}
+
+	return common.MapStr{
+		"@timestamp": common.Time(ts),
+		"type":       "cloudflare_metrics",
+		"zoneTag":    zoneTag,
+		"query":      queryName,
+		"dataset":    row.Dataset,
+		"window": common.MapStr{
+			"start": common.Time(since),
+			"end":   common.Time(until),
+		},
+		"metrics": row.Fields,
+	}
+}
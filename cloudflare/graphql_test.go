@@ -0,0 +1,116 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestQueryGraphQL(t *testing.T) {
+	var received graphQLRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != GRAPHQL_URI {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("X-Auth-Email") != "user@example.com" || r.Header.Get("X-Auth-Key") != "key" {
+			t.Errorf("Missing authentication headers: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"data": {"viewer": {"zones": [{
+			"httpRequests1mGroups": [
+				{"dimensions": {"datetimeMinute": "2017-07-14T02:40:00Z"}, "sum": {"requests": 10}},
+				{"dimensions": {"datetimeMinute": "2017-07-14T02:41:00Z"}, "sum": {"requests": 12}}
+			],
+			"firewallEventsAdaptiveGroups": [{"count": 3, "dimensions": {"action": "block"}}],
+			"unexpected": "value"
+		}]}}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(map[string]interface{}{"api_key": "key", "email": "user@example.com", "api_base": server.URL})
+	since := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	rows, err := c.QueryGraphQL("query { viewer { zones { httpRequests1mGroups } } }", "zone", since, since.Add(5*time.Minute), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"zoneTag": "zone",
+		"since":   "2017-07-14T02:40:00Z",
+		"until":   "2017-07-14T02:45:00Z",
+		"limit":   float64(100),
+	}
+	if received.Query != "query { viewer { zones { httpRequests1mGroups } } }" || !reflect.DeepEqual(received.Variables, expected) {
+		t.Errorf("Unexpected request %+v", received)
+	}
+
+	datasets := map[string]int{}
+	for _, row := range rows {
+		datasets[row.Dataset]++
+	}
+	if !reflect.DeepEqual(datasets, map[string]int{"httpRequests1mGroups": 2, "firewallEventsAdaptiveGroups": 1}) {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+}
+
+func TestQueryGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+	}{
+		{200, `{"data": null, "errors": [{"message": "unknown field"}, {"message": "bad limit"}]}`},
+		{500, `internal error`},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+
+		c := NewClient(map[string]interface{}{"api_key": "key", "email": "user@example.com", "api_base": server.URL})
+		if _, err := c.QueryGraphQL("query", "zone", time.Unix(0, 0), time.Unix(60, 0), 10); err == nil {
+			t.Errorf("Expected an error for %d %s", test.status, test.body)
+		}
+		server.Close()
+	}
+}
+
+func TestBuildGraphQLMapStr(t *testing.T) {
+	since := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	until := since.Add(5 * time.Minute)
+
+	tests := []struct {
+		dimensions map[string]interface{}
+		expected   time.Time
+	}{
+		{map[string]interface{}{"datetimeMinute": "2017-07-14T02:42:00Z"}, time.Date(2017, 7, 14, 2, 42, 0, 0, time.UTC)},
+		{map[string]interface{}{"date": "2017-07-14"}, time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC)},
+		{map[string]interface{}{"datetime": "invalid"}, since},
+		{nil, since},
+	}
+
+	for _, test := range tests {
+		fields := map[string]interface{}{"count": 1}
+		if test.dimensions != nil {
+			fields["dimensions"] = test.dimensions
+		}
+		evt := BuildGraphQLMapStr("requests", "zone", since, until, GraphQLRow{Dataset: "httpRequests1mGroups", Fields: fields})
+		if ts := time.Time(evt["@timestamp"].(common.Time)); !ts.Equal(test.expected) {
+			t.Errorf("Expected the timestamp of %v to be %s, got %s", test.dimensions, test.expected, ts)
+		}
+		if evt["dataset"] != "httpRequests1mGroups" || evt["query"] != "requests" || evt["zoneTag"] != "zone" {
+			t.Errorf("Unexpected event %v", evt)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package cloudflare
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// HEADER_OBJECTS are the objects of the request logs which have a headers list
+var HEADER_OBJECTS = []string{
+	"cacheRequest",
+	"clientRequest",
+	"edgeRequest",
+	"edgeResponse",
+	"originResponse",
+}
+
+// normalizeHeaders converts the headers of a log record, which are either a list of name and value objects or an
+// object of values by name, to a list of name and value objects sorted by name. The names are lower cased, and the
+// values of the headers which are set several times are joined with commas, so that all the values are strings.
+func normalizeHeaders(v interface{}) []interface{} {
+	values := map[string][]string{}
+	add := func(name string, value interface{}) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return
+		}
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, x := range value {
+				values[name] = append(values[name], fmt.Sprint(x))
+			}
+		default:
+			values[name] = append(values[name], fmt.Sprint(value))
+		}
+	}
+
+	switch headers := v.(type) {
+	case []interface{}:
+		for _, item := range headers {
+			if m, ok := item.(map[string]interface{}); ok {
+				name, _ := m["name"].(string)
+				add(name, m["value"])
+			}
+		}
+	case map[string]interface{}:
+		for name, value := range headers {
+			add(name, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	normalized := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		normalized = append(normalized, map[string]interface{}{
+			"name":  name,
+			"value": strings.Join(values[name], ", "),
+		})
+	}
+	return normalized
+}
+
+// HeaderFilter limits the headers of each object of the events to the allowed ones, so that the rarely used headers
+// don't end up in the index
+type HeaderFilter struct {
+	include map[string][]string
+	exclude map[string][]string
+	other   string
+}
+
+// NewHeaderFilter returns a new instance of a HeaderFilter. The include and exclude params are the lower case name
+// patterns of the headers by object, and other is either drop or blob, for the headers which aren't included.
+func NewHeaderFilter(params map[string]interface{}) (*HeaderFilter, error) {
+	f := &HeaderFilter{
+		include: map[string][]string{},
+		exclude: map[string][]string{},
+		other:   params["other"].(string),
+	}
+	if f.other != "drop" && f.other != "blob" {
+		return nil, fmt.Errorf("Unsupported other headers mode '%s'", f.other)
+	}
+
+	for _, kind := range []string{"include", "exclude"} {
+		for object, patterns := range params[kind].(map[string][]string) {
+			if !isHeaderObject(object) {
+				return nil, fmt.Errorf("Unsupported headers object '%s'", object)
+			}
+			for _, pattern := range patterns {
+				pattern = strings.ToLower(pattern)
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("Invalid header pattern '%s': %v", pattern, err)
+				}
+				if kind == "include" {
+					f.include[object] = append(f.include[object], pattern)
+				} else {
+					f.exclude[object] = append(f.exclude[object], pattern)
+				}
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// Enabled returns true if the filter changes anything in the events
+func (f *HeaderFilter) Enabled() bool {
+	return len(f.include) > 0 || len(f.exclude) > 0
+}
+
+// Apply removes the headers of the event which aren't allowed. The excluded headers are always dropped, while the
+// ones which aren't included are kept in the otherHeaders keyword of the object with the blob mode.
+func (f *HeaderFilter) Apply(evt common.MapStr) {
+	for _, object := range HEADER_OBJECTS {
+		include, exclude := f.include[object], f.exclude[object]
+		if include == nil && exclude == nil {
+			continue
+		}
+		v, err := evt.GetValue(object + ".headers")
+		if err != nil {
+			continue
+		}
+		headers, ok := v.([]interface{})
+		if !ok {
+			continue
+		}
+
+		kept := []interface{}{}
+		other := []string{}
+		for _, item := range headers {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := m["name"].(string)
+			switch {
+			case matchesHeader(exclude, name):
+			case include == nil || matchesHeader(include, name):
+				kept = append(kept, item)
+			default:
+				other = append(other, fmt.Sprintf("%s: %v", name, m["value"]))
+			}
+		}
+
+		if len(kept) > 0 {
+			evt.Put(object+".headers", kept)
+		} else {
+			evt.Delete(object + ".headers")
+		}
+		if f.other == "blob" && len(other) > 0 {
+			evt.Put(object+".otherHeaders", strings.Join(other, "\n"))
+		}
+	}
+}
+
+// matchesHeader returns true if the header name matches one of the patterns
+func matchesHeader(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isHeaderObject(object string) bool {
+	for _, o := range HEADER_OBJECTS {
+		if o == object {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func header(name string, value string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "value": value}
+}
+
+func TestNormalizeHeaders(t *testing.T) {
+	tests := []struct {
+		headers  interface{}
+		expected []interface{}
+	}{
+		{nil, nil},
+		{[]interface{}{}, nil},
+		{"Accept: */*", nil},
+		{
+			[]interface{}{
+				map[string]interface{}{"name": "X-Forwarded-For", "value": "1.1.1.1"},
+				map[string]interface{}{"name": " Accept ", "value": "*/*"},
+				map[string]interface{}{"name": "x-forwarded-for", "value": "2.2.2.2"},
+				map[string]interface{}{"name": "", "value": "no name"},
+				map[string]interface{}{"name": "Content-Length", "value": 42},
+				map[string]interface{}{"name": "X-Empty"},
+				"malformed",
+			},
+			[]interface{}{
+				header("accept", "*/*"),
+				header("content-length", "42"),
+				header("x-forwarded-for", "1.1.1.1, 2.2.2.2"),
+			},
+		},
+		{
+			map[string]interface{}{
+				"Set-Cookie":   []interface{}{"a=1", "b=2"},
+				"Content-Type": "text/html",
+				"X-Null":       nil,
+			},
+			[]interface{}{
+				header("content-type", "text/html"),
+				header("set-cookie", "a=1, b=2"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if normalized := normalizeHeaders(test.headers); !reflect.DeepEqual(normalized, test.expected) {
+			t.Errorf("Expected %v to be normalized as %v, got %v", test.headers, test.expected, normalized)
+		}
+	}
+}
+
+func TestNewHeaderFilterValidation(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"other": "keep", "include": map[string][]string{}, "exclude": map[string][]string{}},
+		{"other": "drop", "include": map[string][]string{"originRequest": {"accept"}}, "exclude": map[string][]string{}},
+		{"other": "drop", "include": map[string][]string{}, "exclude": map[string][]string{"clientRequest": {"x-["}}},
+	}
+
+	for _, params := range tests {
+		if _, err := NewHeaderFilter(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestHeaderFilterApply(t *testing.T) {
+	newEvent := func() common.MapStr {
+		return common.MapStr{
+			"clientRequest": common.MapStr{
+				"headers": []interface{}{
+					header("accept", "*/*"),
+					header("authorization", "Bearer token"),
+					header("x-custom-id", "1"),
+					header("x-forwarded-for", "1.1.1.1"),
+				},
+			},
+			"edgeResponse": common.MapStr{
+				"headers": []interface{}{header("cf-cache-status", "HIT"), header("server", "cloudflare")},
+			},
+			"originResponse": common.MapStr{
+				"headers": []interface{}{header("server", "nginx"), header("x-powered-by", "PHP")},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		other    string
+		include  map[string][]string
+		exclude  map[string][]string
+		expected common.MapStr
+	}{
+		{
+			name:    "include with drop",
+			other:   "drop",
+			include: map[string][]string{"clientRequest": {"Accept", "x-forwarded-*"}},
+			expected: common.MapStr{
+				"clientRequest": common.MapStr{
+					"headers": []interface{}{header("accept", "*/*"), header("x-forwarded-for", "1.1.1.1")},
+				},
+			},
+		},
+		{
+			name:    "include with blob",
+			other:   "blob",
+			include: map[string][]string{"clientRequest": {"accept", "x-forwarded-*"}, "originResponse": {"content-*"}},
+			expected: common.MapStr{
+				"clientRequest": common.MapStr{
+					"headers":      []interface{}{header("accept", "*/*"), header("x-forwarded-for", "1.1.1.1")},
+					"otherHeaders": "authorization: Bearer token\nx-custom-id: 1",
+				},
+				"originResponse": common.MapStr{
+					"otherHeaders": "server: nginx\nx-powered-by: PHP",
+				},
+			},
+		},
+		{
+			name:    "exclude only",
+			other:   "blob",
+			exclude: map[string][]string{"clientRequest": {"authorization", "x-*"}, "edgeResponse": {"*"}},
+			expected: common.MapStr{
+				"clientRequest": common.MapStr{
+					"headers": []interface{}{header("accept", "*/*")},
+				},
+				"edgeResponse": common.MapStr{},
+			},
+		},
+		{
+			name:    "exclude wins over include",
+			other:   "blob",
+			include: map[string][]string{"clientRequest": {"*"}},
+			exclude: map[string][]string{"clientRequest": {"authorization"}},
+			expected: common.MapStr{
+				"clientRequest": common.MapStr{
+					"headers": []interface{}{header("accept", "*/*"), header("x-custom-id", "1"), header("x-forwarded-for", "1.1.1.1")},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if test.include == nil {
+			test.include = map[string][]string{}
+		}
+		if test.exclude == nil {
+			test.exclude = map[string][]string{}
+		}
+		f, err := NewHeaderFilter(map[string]interface{}{"other": test.other, "include": test.include, "exclude": test.exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		evt := newEvent()
+		f.Apply(evt)
+
+		// The objects without any rule are kept as is
+		expected := newEvent()
+		for object, v := range test.expected {
+			expected[object] = v
+		}
+		if !reflect.DeepEqual(evt, expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, expected, evt)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package cloudflare
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ListLocalFiles returns the regular files matching any of the given glob patterns, or contained in any of the
+// given directories, sorted by path
+func ListLocalFiles(paths []string) ([]string, error) {
+
+	seen := map[string]bool{}
+	files := []string{}
+
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			p = filepath.Join(p, "*")
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if abs, err := filepath.Abs(m); err == nil {
+				m = abs
+			}
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
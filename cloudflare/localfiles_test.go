@@ -0,0 +1,59 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-local-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"b.ndjson", "a.ndjson", "c.log.gz", "logs/d.ndjson"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		paths    []string
+		expected []string
+	}{
+		// The directories are listed without their subdirectories
+		{[]string{dir}, []string{path("a.ndjson"), path("b.ndjson"), path("c.log.gz")}},
+		{[]string{path("*.ndjson")}, []string{path("a.ndjson"), path("b.ndjson")}},
+		// The files matching several paths are only listed once
+		{[]string{path("*.ndjson"), path("a.*"), path("logs")}, []string{path("a.ndjson"), path("b.ndjson"), path("logs/d.ndjson")}},
+		{[]string{path("missing/*")}, []string{}},
+	}
+
+	for _, test := range tests {
+		files, err := ListLocalFiles(test.paths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(files, test.expected) {
+			t.Errorf("Expected %v to list %v, got %v", test.paths, test.expected, files)
+		}
+	}
+
+	if _, err := ListLocalFiles([]string{path("[")}); err == nil {
+		t.Errorf("Expected an error for an invalid pattern")
+	}
+}
@@ -2,7 +2,9 @@ package cloudflare
 
 import (
 	"bufio"
-	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,6 +16,16 @@ import (
 	"github.com/pquerna/ffjson/ffjson"
 )
 
+// MAX_LOG_LINE_SIZE is the maximum size of a single log line, which can be well over the default 64KB of the
+// scanner when the headers or cookies are logged
+const MAX_LOG_LINE_SIZE = 16 * 1024 * 1024
+
+var (
+	errDuplicateEvent = errors.New("Event with an already seen Ray ID")
+	errSampledOut     = errors.New("Event not part of the sample")
+	ErrLogTooLarge    = errors.New("Log content exceeds the maximum size")
+)
+
 type LogConsumer struct {
 	TotalLogFileSegments  int
 	cloudflareClient      *CloudflareClient
@@ -22,11 +34,35 @@ type LogConsumer struct {
 	CompletedNotifier     chan bool
 	ProcessorTerminateSig chan bool
 	WaitGroup             sync.WaitGroup
+	RayIDCache            *RayIDCache      // Drops the events with an already seen Ray ID when set
+	DeadLetterFile        *DeadLetterFile  // Receives the log lines which could not be processed when set
+	Fields                []string         // Flat log fields requested from the API, or the default fields when empty
+	SampleRate            float64          // Ratio of the logs sampled by the API, between 0 and 1
+	Sampler               *RayIDSampler    // Keeps a sample of the events based on their Ray ID when set
+	OutputSchema          string           // Schema of the published events, either cloudflare or ecs
+	GeoIP                 *GeoIPEnricher   // Adds the location of the client and origin IPs to the events when set
+	UserAgentParser       *UserAgentParser // Adds the browser, OS and device of the client to the events when set
+	URIParser             *URIParser       // Adds the path, query and extension of the requested URIs when set
+	Privacy               *PrivacyFilter   // Removes the personal data from the events when set
+	HeaderFilter          *HeaderFilter    // Limits the headers of the events to the allowed ones when set
+	FieldRules            []*FieldRule     // Includes, excludes and renames the fields of the events of some zones
+	downloadSlots         chan struct{}    // Limits the concurrent downloads to TotalLogFileSegments
+	segmentsLock          sync.Mutex
+	pendingSegments       map[string]TimeRange
+	completedSegments     []TimeRange
+	failedSegments        []TimeRange
+	localFiles            map[string]bool
+	fileSources           map[string]string
+	completedFiles        []string
+	failedFiles           []string
 }
 
 // NewLogConsumer reutrns a instance of the LogConsumer struct
 func NewLogConsumer(cfEmail string, cfAPIKey string, numSegments int, eventBufferSize int, processors int) *LogConsumer {
 
+	if numSegments < 1 {
+		numSegments = 1
+	}
 	lc := &LogConsumer{
 		TotalLogFileSegments:  numSegments,
 		LogFilesReady:         make(chan string, numSegments*10),
@@ -34,6 +70,11 @@ func NewLogConsumer(cfEmail string, cfAPIKey string, numSegments int, eventBuffe
 		CompletedNotifier:     make(chan bool, 1),
 		ProcessorTerminateSig: make(chan bool, processors),
 		WaitGroup:             sync.WaitGroup{},
+		downloadSlots:         make(chan struct{}, numSegments),
+		pendingSegments:       map[string]TimeRange{},
+		localFiles:            map[string]bool{},
+		fileSources:           map[string]string{},
+		SampleRate:            1,
 	}
 	lc.cloudflareClient = NewClient(map[string]interface{}{
 		"api_key": cfAPIKey,
@@ -45,52 +86,154 @@ func NewLogConsumer(cfEmail string, cfAPIKey string, numSegments int, eventBuffe
 
 // DownloadCurrentLogFiles downloads the log file segments from the Cloudflare ELS API
 func (lc *LogConsumer) DownloadCurrentLogFiles(zoneTag string, timeStart int, timeEnd int) {
+	lc.DownloadLogSegments(zoneTag, SplitTimeRange(timeStart, timeEnd, lc.TotalLogFileSegments))
+}
 
-	segmentSize := (timeEnd - timeStart) / lc.TotalLogFileSegments
-	currTimeStart := timeStart
-	currTimeEnd := currTimeStart + segmentSize
-	var timeNow int
+// DownloadLogSegments downloads each of the given time ranges as a seperate log file from the Cloudflare ELS API, with
+// up to TotalLogFileSegments downloads at a time
+func (lc *LogConsumer) DownloadLogSegments(zoneTag string, segments []TimeRange) {
 
-	lc.WaitGroup.Add(lc.TotalLogFileSegments)
+	lc.WaitGroup.Add(len(segments))
 
-	for i := 0; i < lc.TotalLogFileSegments; i++ {
-		go func(lc *LogConsumer, segmentNum int, currTimeStart int, currTimeEnd int) {
+	for i, segment := range segments {
+		go func(lc *LogConsumer, segmentNum int, segment TimeRange) {
 
-			timeNow = int(time.Now().UTC().Unix())
+			timeNow := int(time.Now().UTC().Unix())
 
-			logp.Info("Downloading log segment #%d from %d to %d", segmentNum, currTimeStart, currTimeEnd)
-			//logp.Info("Downloading log segment #%d from %d to %d", segmentNum, currTimeStart, currTimeEnd)
+			lc.downloadSlots <- struct{}{}
+			logp.Info("Downloading log segment #%d from %d to %d", segmentNum, segment.Start, segment.End)
 
 			filename, err := lc.cloudflareClient.GetLogRangeFromTimestamp(map[string]interface{}{
 				"zone_tag":   zoneTag,
-				"time_start": currTimeStart,
-				"time_end":   currTimeEnd,
+				"time_start": segment.Start,
+				"time_end":   segment.End,
+				"fields":     lc.Fields,
+				"sample":     lc.SampleRate,
 			})
+			<-lc.downloadSlots
 
-			if err != nil {
+			if err == ErrEmptyLogFile {
+				logp.Info("No logs found for segment #%d from %d to %d", segmentNum, segment.Start, segment.End)
+				lc.segmentDone(segment, nil)
+				lc.WaitGroup.Done()
+				return
+			} else if err != nil {
 				logp.Err("Could not download logs from CF: %v", err)
+				lc.segmentDone(segment, err)
+				lc.WaitGroup.Done()
 				return
 			}
 
+			lc.segmentsLock.Lock()
+			lc.pendingSegments[filename] = segment
+			lc.segmentsLock.Unlock()
+
 			lc.LogFilesReady <- filename
 			logp.Info("Total download time for log file: %d seconds", (int(time.Now().UTC().Unix()) - timeNow))
-			//logp.Info("Total download time for log file: %d seconds", (int(time.Now().UTC().Unix()) - timeNow))
 
-		}(lc, i, currTimeStart, currTimeEnd)
-
-		currTimeStart = currTimeEnd + 1
-		currTimeEnd = currTimeStart + segmentSize
+		}(lc, i, segment)
 
 		runtime.Gosched()
 	}
 
 }
 
+// segmentDone records the outcome of the download and processing of a log segment
+func (lc *LogConsumer) segmentDone(segment TimeRange, err error) {
+	lc.segmentsLock.Lock()
+	if err != nil {
+		lc.failedSegments = append(lc.failedSegments, segment)
+	} else {
+		lc.completedSegments = append(lc.completedSegments, segment)
+	}
+	lc.segmentsLock.Unlock()
+}
+
+// logFileDone records the outcome of processing a log file, and deletes it if it was downloaded
+func (lc *LogConsumer) logFileDone(logFileName string, err error) {
+
+	lc.segmentsLock.Lock()
+	segment, isSegment := lc.pendingSegments[logFileName]
+	delete(lc.pendingSegments, logFileName)
+	isLocal := lc.localFiles[logFileName]
+	delete(lc.localFiles, logFileName)
+	delete(lc.fileSources, logFileName)
+	if isLocal && err != nil {
+		lc.failedFiles = append(lc.failedFiles, logFileName)
+	} else if isLocal {
+		lc.completedFiles = append(lc.completedFiles, logFileName)
+	}
+	lc.segmentsLock.Unlock()
+
+	if isSegment {
+		lc.segmentDone(segment, err)
+	}
+	if !isLocal {
+		DeleteLogLife(logFileName)
+	}
+}
+
+// QueueLocalFiles queues the given local log files, either gzip compressed or not, for processing. Unlike the
+// downloaded log files, they're left in place once processed.
+func (lc *LogConsumer) QueueLocalFiles(files []string) {
+
+	lc.WaitGroup.Add(len(files))
+
+	lc.segmentsLock.Lock()
+	for _, f := range files {
+		lc.localFiles[f] = true
+	}
+	lc.segmentsLock.Unlock()
+
+	go func() {
+		for _, f := range files {
+			lc.LogFilesReady <- f
+		}
+	}()
+}
+
+// SetFileSource records where a queued local file came from, such as the key of a Logpush object, so that it's
+// recorded in the dead-letter file instead of the file name
+func (lc *LogConsumer) SetFileSource(filename string, source string) {
+	lc.segmentsLock.Lock()
+	lc.fileSources[filename] = source
+	lc.segmentsLock.Unlock()
+}
+
+// sourceOf returns where the lines of the log file can be fetched again: the time range of a downloaded segment,
+// the recorded source of a local file, or else its path
+func (lc *LogConsumer) sourceOf(logFileName string) string {
+	lc.segmentsLock.Lock()
+	defer lc.segmentsLock.Unlock()
+	if segment, ok := lc.pendingSegments[logFileName]; ok {
+		return "segment " + segment.String()
+	}
+	if source, ok := lc.fileSources[logFileName]; ok {
+		return source
+	}
+	return logFileName
+}
+
+// FileResults returns the local files which were completed and the ones which failed since the last call, then resets them
+func (lc *LogConsumer) FileResults() ([]string, []string) {
+	lc.segmentsLock.Lock()
+	completed, failed := lc.completedFiles, lc.failedFiles
+	lc.completedFiles, lc.failedFiles = nil, nil
+	lc.segmentsLock.Unlock()
+	return completed, failed
+}
+
+// SegmentResults returns the completed and the failed segments since the last call, then resets them
+func (lc *LogConsumer) SegmentResults() ([]TimeRange, []TimeRange) {
+	lc.segmentsLock.Lock()
+	completed, failed := lc.completedSegments, lc.failedSegments
+	lc.completedSegments, lc.failedSegments = nil, nil
+	lc.segmentsLock.Unlock()
+	return completed, failed
+}
+
 func (lc *LogConsumer) PrepareEvents() {
 
-	var l map[string]interface{}
-	var evt common.MapStr
-	var logItem []byte
 	completedProcessingNotifer := make(chan bool, 1)
 
 	// goroutine that will send notification to the goroutine publishing the events to say it's done all the files
@@ -113,45 +256,37 @@ func (lc *LogConsumer) PrepareEvents() {
 			logp.Info("Log file %s ready for processing.", logFileName)
 			fh, err := os.Open(logFileName)
 			if err != nil {
-				logp.Err("Could not open gziped file for reading: %v", err)
-				DeleteLogLife(logFileName)
+				logp.Err("Could not open log file for reading: %v", err)
+				lc.logFileDone(logFileName, err)
 				lc.WaitGroup.Done()
 				continue
 			}
 
 			/* Now we need to read the content form the file, split line by line and itterate over them */
-			logp.Info("Opening gziped file %s for reading...", logFileName)
-			gz, err := gzip.NewReader(fh)
+			logp.Info("Opening log file %s for reading...", logFileName)
+			reader, err := openLogReader(fh)
 			if err != nil {
 				logp.Err("Could not open file for reading: %v", err)
-				DeleteLogLife(logFileName)
+				fh.Close()
+				lc.logFileDone(logFileName, err)
 				lc.WaitGroup.Done()
 				continue
 			}
 
 			timePreIndex := int(time.Now().UTC().Unix())
-			scanner := bufio.NewScanner(gz)
-
-			for scanner.Scan() {
-				logItem = scanner.Bytes()
-				err := ffjson.Unmarshal(logItem, &l)
-				if err == nil {
-					evt = BuildMapStr(l)
-					evt["@timestamp"] = common.Time(time.Unix(0, int64(l["timestamp"].(float64))))
-					evt["type"] = "cloudflare"
-					evt["cfbeat_log_file"] = filepath.Base(logFileName)
-					lc.EventsReady <- evt
-				} else {
-					logp.Err("Could not load JSON: %s", err)
-				}
+			err = lc.processLogReader(logFileName, reader, func(evt common.MapStr, rayID string) {
+				lc.EventsReady <- evt
+			})
+			if err != nil {
+				logp.Err("Could not read all entries from %s: %v", logFileName, err)
 			}
 
 			logp.Info("Total processing time: %d seconds", (int(time.Now().UTC().Unix()) - timePreIndex))
 
 			// Now close the related handles and delete the log file
-			gz.Close()
+			reader.Close()
 			fh.Close()
-			DeleteLogLife(logFileName)
+			lc.logFileDone(logFileName, err)
 			lc.WaitGroup.Done()
 			runtime.Gosched()
 
@@ -160,3 +295,212 @@ func (lc *LogConsumer) PrepareEvents() {
 	} // End for loop
 
 }
+
+// BuildEvents builds the events for all of the log lines read from the reader, which can be gzip compressed.
+// ErrLogTooLarge is returned if the uncompressed content exceeds maxSize bytes. The Ray IDs recorded for the
+// deduplication are returned along with the events, so that they can be forgotten if the events aren't published.
+func (lc *LogConsumer) BuildEvents(sourceName string, r io.Reader, maxSize int64) ([]common.MapStr, []string, error) {
+
+	reader, err := openLogReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+
+	limited := &io.LimitedReader{R: reader, N: maxSize + 1}
+	events := []common.MapStr{}
+	rayIDs := []string{}
+	err = lc.processLogReader(sourceName, limited, func(evt common.MapStr, rayID string) {
+		events = append(events, evt)
+		if rayID != "" {
+			rayIDs = append(rayIDs, rayID)
+		}
+	})
+	if limited.N <= 0 {
+		lc.ForgetRayIDs(rayIDs)
+		return nil, nil, ErrLogTooLarge
+	} else if err != nil {
+		lc.ForgetRayIDs(rayIDs)
+		return nil, nil, err
+	}
+
+	return events, rayIDs, nil
+}
+
+// ForgetRayIDs removes the given Ray IDs from the deduplication cache, so that the events which could not be
+// published aren't dropped as duplicates when they're received again
+func (lc *LogConsumer) ForgetRayIDs(rayIDs []string) {
+	if lc.RayIDCache != nil {
+		lc.RayIDCache.Forget(rayIDs)
+	}
+}
+
+// processLogReader builds the event for each line read from the reader and passes it to emit. Lines which can't be
+// processed are sent to the dead-letter file, while the events with an already seen Ray ID are dropped.
+func (lc *LogConsumer) processLogReader(logFileName string, reader io.Reader, emit func(common.MapStr, string)) error {
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), MAX_LOG_LINE_SIZE)
+	duplicates := 0
+	sampledOut := 0
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		evt, rayID, err := lc.processLogLine(scanner.Bytes())
+		if err == errDuplicateEvent {
+			duplicates++
+			continue
+		} else if err == errSampledOut {
+			sampledOut++
+			continue
+		} else if err != nil {
+			lc.deadLetter(logFileName, lineNumber, scanner.Bytes(), err)
+			continue
+		}
+		evt["cfbeat_log_file"] = filepath.Base(logFileName)
+		emit(evt, rayID)
+	}
+
+	if duplicates > 0 {
+		logp.Info("Dropped %d duplicate events from %s", duplicates, logFileName)
+	}
+	if sampledOut > 0 {
+		logp.Debug("log-consumer", "Dropped %d events not part of the sample from %s", sampledOut, logFileName)
+	}
+
+	return scanner.Err()
+}
+
+// processLogLine builds the event for a single log line, along with the Ray ID recorded in the deduplication cache
+// if any, recovering from any panic so that an unexpected record never takes the beat down
+func (lc *LogConsumer) processLogLine(logItem []byte) (evt common.MapStr, recorded string, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			evt, err = nil, fmt.Errorf("Recovered from panic while building event: %v", r)
+		}
+	}()
+
+	var l map[string]interface{}
+	if err := ffjson.Unmarshal(logItem, &l); err != nil {
+		return nil, "", fmt.Errorf("Could not load JSON: %v", err)
+	}
+	if l, err = NestLogRecord(l); err != nil {
+		return nil, "", err
+	}
+
+	if lc.Sampler != nil {
+		if rayID, _ := l["rayId"].(string); !lc.Sampler.Keep(rayID) {
+			return nil, "", errSampledOut
+		}
+	}
+
+	if lc.RayIDCache != nil {
+		// Records without a timestamp can't be placed in the window, so they're never considered duplicates
+		rayID, _ := l["rayId"].(string)
+		if ts := nanoseconds(common.MapStr(l), "timestamp"); rayID != "" && ts > 0 {
+			if lc.RayIDCache.Seen(rayID, ts) {
+				return nil, "", errDuplicateEvent
+			}
+			recorded = rayID
+		}
+	}
+
+	evt, err = lc.BuildEnrichedEvent(l)
+	return evt, recorded, err
+}
+
+// BuildEnrichedEvent builds the event of a log record and runs it through the configured enrichment, privacy, output
+// schema and field rules stages. The personal data is removed once the GeoIP lookups are done, and before the URIs
+// are parsed, so that it can't end up in any of the published fields.
+func (lc *LogConsumer) BuildEnrichedEvent(l map[string]interface{}) (common.MapStr, error) {
+	l, err := NestLogRecord(l)
+	if err != nil {
+		return nil, err
+	}
+	evt, err := BuildEvent(l)
+	if err != nil {
+		return nil, err
+	}
+	evt["sampleRate"] = lc.EffectiveSampleRate()
+
+	if lc.GeoIP != nil {
+		lc.GeoIP.Enrich(evt)
+	}
+	if lc.Privacy != nil {
+		lc.Privacy.Apply(evt)
+	}
+	if lc.HeaderFilter != nil {
+		lc.HeaderFilter.Apply(evt)
+	}
+	if lc.UserAgentParser != nil {
+		lc.UserAgentParser.Enrich(evt)
+	}
+	if lc.URIParser != nil {
+		lc.URIParser.Enrich(evt)
+	}
+
+	if lc.OutputSchema == "ecs" {
+		evt = ToECS(evt)
+	}
+
+	// The field rules apply to the published fields, so they're the last stage
+	for _, rule := range lc.FieldRules {
+		if rule.AppliesTo(l) {
+			rule.Apply(evt)
+		}
+	}
+
+	return evt, nil
+}
+
+// EffectiveSampleRate returns the ratio of the logs which are published, combining the sampling done by the API and
+// the one done by the Ray ID sampler. Counts can be scaled back up by dividing them by this rate.
+func (lc *LogConsumer) EffectiveSampleRate() float64 {
+	rate := lc.SampleRate
+	if lc.Sampler != nil {
+		rate *= lc.Sampler.Rate
+	}
+	return rate
+}
+
+// BuildEvent builds the event to be published for a decoded log record
+func BuildEvent(l map[string]interface{}) (evt common.MapStr, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			evt, err = nil, fmt.Errorf("Recovered from panic while building event: %v", r)
+		}
+	}()
+
+	ts := nanoseconds(common.MapStr(l), "timestamp")
+	if ts <= 0 {
+		return nil, errors.New("Missing or invalid timestamp")
+	}
+
+	evt = BuildMapStr(l)
+	DecodeFlags(evt)
+	NormalizeCodes(evt)
+	addTimings(evt, l)
+	evt["@timestamp"] = common.Time(time.Unix(0, ts))
+	evt["type"] = "cloudflare"
+
+	return evt, nil
+}
+
+// deadLetter records a log line which could not be processed. As the privacy filter can't be applied to a line
+// which couldn't be parsed, only its source and line number are recorded when the filter is enabled.
+func (lc *LogConsumer) deadLetter(logFileName string, lineNumber int, line []byte, reason error) {
+	deadLetterEvents.Add(1)
+	logp.Err("Could not process line %d of %s: %v", lineNumber, logFileName, reason)
+	if lc.DeadLetterFile == nil {
+		return
+	}
+	if lc.Privacy != nil {
+		line = nil
+	}
+	if err := lc.DeadLetterFile.Write(lc.sourceOf(logFileName), lineNumber, line, reason); err != nil {
+		logp.Err("Could not write to the dead-letter file: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadLogSegmentsLimitsConcurrency(t *testing.T) {
+	var lock sync.Mutex
+	current, highest, requests := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		current++
+		requests++
+		if current > highest {
+			highest = current
+		}
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		lock.Lock()
+		current--
+		lock.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	lc := NewLogConsumer("user@example.com", "key", 3, 10, 1)
+	lc.cloudflareClient.apiBase = server.URL
+
+	segments := SplitLongTimeRanges([]TimeRange{{Start: 1500000000, End: 1500000000 + 12*3600 - 1}}, MAX_SEGMENT_SECONDS)
+	lc.DownloadLogSegments("zone", segments)
+	lc.WaitGroup.Wait()
+
+	if requests != len(segments) {
+		t.Errorf("%d requests were made, expected %d", requests, len(segments))
+	}
+	if highest > 3 {
+		t.Errorf("Up to %d segments were downloaded at once, expected at most 3", highest)
+	}
+	if completed, failed := lc.SegmentResults(); len(completed) != 0 || len(failed) != len(segments) {
+		t.Errorf("Expected all the %d segments to fail, got %d completed and %d failed", len(segments), len(completed), len(failed))
+	}
+}
+
+func TestDeadLetterLeavesOutLinesWithPrivacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-dead-letter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, privacy := range []bool{false, true} {
+		name := fmt.Sprintf("dead-letter-%v.ndjson", privacy)
+		d, err := NewDeadLetterFile(dir, name, 1024, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lc := NewLogConsumer("", "", 1, 1, 1)
+		lc.DeadLetterFile = d
+		if privacy {
+			lc.Privacy = newTestPrivacyFilter(t, map[string]interface{}{"client_ip": "hash"})
+		}
+
+		line := []byte(`{"clientIP": "203.0.113.42"`)
+		lc.deadLetter("cloudflare_logs.txt.gz", 7, line, errors.New("Could not load JSON"))
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entry DeadLetterEntry
+		if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.LineNumber != 7 || entry.Source != "cloudflare_logs.txt.gz" {
+			t.Errorf("Unexpected entry %+v", entry)
+		}
+		if privacy && entry.Line != nil {
+			t.Errorf("Expected the line to be left out with privacy enabled, got %q", entry.Line)
+		}
+		if !privacy && string(entry.Line) != string(line) {
+			t.Errorf("The line is %q, expected %q", entry.Line, line)
+		}
+	}
+}
@@ -1,14 +1,19 @@
 package cloudflare
 
 import (
+	"bufio"
+	"compress/gzip"
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/franela/goreq"
 )
 
+var ErrEmptyLogFile = errors.New("Request body is empty")
+
 type RequestLogFile struct {
 	Filename string
 }
@@ -42,7 +47,7 @@ func (l *RequestLogFile) SaveFromHttpResponseBody(respBody *goreq.Body) (int64,
 	if err != nil {
 		return 0, err
 	} else if nBytes == 0 {
-		return 0, errors.New("Request body is empty")
+		return 0, ErrEmptyLogFile
 	}
 
 	return nBytes, nil
@@ -60,3 +65,15 @@ func DeleteLogLife(filename string) {
 		logp.Debug("log-consumer", "[ERROR] Could not delete local log file %s: %s", filename, err.Error())
 	}
 }
+
+// openLogReader returns a reader for the log file content, decompressing it if it's gzip compressed
+func openLogReader(r io.Reader) (io.ReadCloser, error) {
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+
+	return ioutil.NopCloser(br), nil
+}
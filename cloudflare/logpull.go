@@ -0,0 +1,142 @@
+package cloudflare
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// LOGPULL_FIELDS maps the flat field names of the log records returned when the fields are requested, such as
+// ClientIP, to the nested fields of the default log records, such as client.ip, from which the events are built
+var LOGPULL_FIELDS = map[string]string{
+	"CacheCacheStatus":               "cache.cacheStatus",
+	"CacheResponseBytes":             "cacheResponse.bytes",
+	"CacheResponseStatus":            "cacheResponse.status",
+	"ClientASN":                      "client.asNum",
+	"ClientCountry":                  "client.country",
+	"ClientDeviceType":               "client.deviceType",
+	"ClientIP":                       "client.ip",
+	"ClientIPClass":                  "client.ipClass",
+	"ClientRequestBytes":             "clientRequest.bytes",
+	"ClientRequestHost":              "clientRequest.httpHost",
+	"ClientRequestMethod":            "clientRequest.httpMethod",
+	"ClientRequestProtocol":          "clientRequest.httpProtocol",
+	"ClientRequestReferer":           "clientRequest.referer",
+	"ClientRequestURI":               "clientRequest.uri",
+	"ClientRequestUserAgent":         "clientRequest.userAgent",
+	"ClientSSLCipher":                "client.sslCipher",
+	"ClientSSLProtocol":              "client.sslProtocol",
+	"ClientSrcPort":                  "client.srcPort",
+	"EdgeColoID":                     "edge.colo",
+	"EdgeEndTimestamp":               "edge.endTimestamp",
+	"EdgePathingOp":                  "edge.pathingOp",
+	"EdgePathingSrc":                 "edge.pathingSrc",
+	"EdgePathingStatus":              "edge.pathingStatus",
+	"EdgeRateLimitID":                "edge.rateLimitRuleId",
+	"EdgeRequestHost":                "edgeRequest.httpHost",
+	"EdgeResponseBytes":              "edgeResponse.bytes",
+	"EdgeResponseCompressionRatio":   "edgeResponse.compressionRatio",
+	"EdgeResponseContentType":        "edgeResponse.contentType",
+	"EdgeResponseStatus":             "edgeResponse.status",
+	"EdgeServerIP":                   "edge.flServerIp",
+	"EdgeStartTimestamp":             "edge.startTimestamp",
+	"OriginIP":                       "origin.ip",
+	"OriginResponseBytes":            "originResponse.bytes",
+	"OriginResponseHTTPExpires":      "originResponse.httpExpires",
+	"OriginResponseHTTPLastModified": "originResponse.httpLastModified",
+	"OriginResponseStatus":           "originResponse.status",
+	"OriginResponseTime":             "origin.responseTime",
+	"OriginSSLProtocol":              "origin.sslProtocol",
+	"RayID":                          "rayId",
+	"ZoneID":                         "zoneId",
+}
+
+// REQUIRED_LOG_FIELDS are the fields which are always requested along with the configured ones, as the events can't
+// be timestamped and deduplicated without them
+var REQUIRED_LOG_FIELDS = []string{"EdgeStartTimestamp", "RayID"}
+
+// CheckLogFields returns the configured log fields along with the required ones, or an error listing the fields
+// which can't be converted into the nested log records
+func CheckLogFields(fields []string) ([]string, error) {
+
+	unsupported := []string{}
+	for _, name := range fields {
+		if _, ok := LOGPULL_FIELDS[name]; !ok {
+			unsupported = append(unsupported, name)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("The log_fields %s are not supported", strings.Join(unsupported, ", "))
+	}
+
+	checked := append([]string{}, fields...)
+	for _, required := range REQUIRED_LOG_FIELDS {
+		if !containsString(checked, required) {
+			checked = append(checked, required)
+		}
+	}
+	return checked, nil
+}
+
+// NestLogRecord converts a log record with the flat field names into a nested log record, with the start of the
+// request at the edge as its timestamp. Log records which are already nested are returned as is.
+func NestLogRecord(l map[string]interface{}) (map[string]interface{}, error) {
+
+	nested := common.MapStr{}
+	flat := false
+	for name, value := range l {
+		path, ok := LOGPULL_FIELDS[name]
+		if !ok {
+			continue
+		}
+		flat = true
+		if value != nil {
+			if _, err := nested.Put(path, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !flat {
+		return l, nil
+	}
+
+	ts, ok := l["EdgeStartTimestamp"]
+	if !ok {
+		return nil, errors.New("Missing EdgeStartTimestamp")
+	}
+	nested["timestamp"] = ts
+
+	// The nested objects are read as plain maps when building the events
+	for k, v := range nested {
+		if m, ok := v.(common.MapStr); ok {
+			nested[k] = toPlainMap(m)
+		}
+	}
+	return map[string]interface{}(nested), nil
+}
+
+// toPlainMap converts the nested MapStr objects into plain maps
+func toPlainMap(m common.MapStr) map[string]interface{} {
+	plain := map[string]interface{}{}
+	for k, v := range m {
+		if inner, ok := v.(common.MapStr); ok {
+			plain[k] = toPlainMap(inner)
+		} else {
+			plain[k] = v
+		}
+	}
+	return plain
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestBuildEnrichedEventFromFlatRecord(t *testing.T) {
+	l := map[string]interface{}{
+		"ClientIP":               "192.0.2.10",
+		"ClientRequestHost":      "example.com",
+		"ClientRequestMethod":    "GET",
+		"ClientRequestURI":       "/index.html",
+		"EdgeResponseStatus":     float64(200),
+		"EdgeStartTimestamp":     float64(1500000000000000000),
+		"EdgeEndTimestamp":       float64(1500000000250000000),
+		"CacheCacheStatus":       "hit",
+		"RayID":                  "3a6b5c5d6e7f8a9b",
+		"ClientRequestUserAgent": nil,
+	}
+
+	lc := &LogConsumer{SampleRate: 1}
+	evt, err := lc.BuildEnrichedEvent(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ts := time.Time(evt["@timestamp"].(common.Time)); !ts.Equal(time.Unix(0, 1500000000000000000)) {
+		t.Errorf("@timestamp is %v", ts)
+	}
+	expected := map[string]interface{}{
+		"rayId":                    "3a6b5c5d6e7f8a9b",
+		"client.ip":                "192.0.2.10",
+		"clientRequest.httpHost":   "example.com",
+		"clientRequest.httpMethod": "GET",
+		"clientRequest.uri":        "/index.html",
+		"edgeResponse.status":      float64(200),
+		"cache.cacheStatus":        "hit",
+		"timing.edgeDuration":      float64(250),
+	}
+	for key, value := range expected {
+		if v, err := evt.GetValue(key); err != nil || !reflect.DeepEqual(v, value) {
+			t.Errorf("%s is %v (%v), expected %v", key, v, err, value)
+		}
+	}
+}
+
+func TestNestLogRecord(t *testing.T) {
+	nested := map[string]interface{}{"rayId": "abc", "timestamp": float64(1)}
+	if l, err := NestLogRecord(nested); err != nil || !reflect.DeepEqual(l, nested) {
+		t.Errorf("The nested record was changed to %v (%v)", l, err)
+	}
+
+	if _, err := NestLogRecord(map[string]interface{}{"RayID": "abc"}); err == nil {
+		t.Error("The flat record without EdgeStartTimestamp wasn't rejected")
+	}
+
+	l, err := NestLogRecord(map[string]interface{}{"RayID": "abc", "EdgeStartTimestamp": float64(1), "ClientIP": "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"rayId":     "abc",
+		"timestamp": float64(1),
+		"edge":      map[string]interface{}{"startTimestamp": float64(1)},
+		"client":    map[string]interface{}{"ip": "192.0.2.1"},
+	}
+	if !reflect.DeepEqual(l, expected) {
+		t.Errorf("Got %v, expected %v", l, expected)
+	}
+}
+
+func TestCheckLogFields(t *testing.T) {
+	fields, err := CheckLogFields([]string{"ClientIP", "RayID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ClientIP", "RayID", "EdgeStartTimestamp"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Got %v, expected %v", fields, expected)
+	}
+
+	if _, err := CheckLogFields([]string{"ClientIP", "WAFProfile", "Unknown"}); err == nil {
+		t.Error("The unsupported fields weren't rejected")
+	}
+}
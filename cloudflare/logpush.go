@@ -0,0 +1,131 @@
+package cloudflare
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+const (
+	LOGPUSH_PROCESSED_TAG = "cloudflarebeat-processed"
+)
+
+// LogpushBucket lists and downloads the log files pushed by Cloudflare Logpush to an S3 bucket
+type LogpushBucket struct {
+	settings *awsS3Settings
+	svc      *s3.S3
+}
+
+// NewLogpushBucket returns a new instance of a LogpushBucket struct
+func NewLogpushBucket(config map[string]string) (*LogpushBucket, error) {
+
+	if config["bucket_name"] == "" {
+		return nil, errors.New("Must specify the Logpush S3 bucket name.")
+	}
+
+	b := &LogpushBucket{
+		settings: &awsS3Settings{
+			awsAccesKey:        config["aws_access_key"],
+			awsSecretAccessKey: config["aws_secret_access_key"],
+			s3BucketName:       config["bucket_name"],
+			region:             config["region"],
+			endpoint:           config["endpoint"],
+		},
+	}
+	if b.settings.region == "" {
+		b.settings.region = "us-east-1"
+	}
+
+	svc, err := newS3Service(b.settings)
+	if err != nil {
+		return nil, err
+	}
+	b.svc = svc
+
+	return b, nil
+}
+
+// ListNewObjects returns up to maxKeys object keys under the prefix which come after the given key, in
+// lexicographical order. As Logpush names the objects by date and time, this is also their chronological order.
+func (b *LogpushBucket) ListNewObjects(prefix string, startAfter string, maxKeys int) ([]string, error) {
+
+	params := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(b.settings.s3BucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(maxKeys)),
+	}
+	if startAfter != "" {
+		params.StartAfter = aws.String(startAfter)
+	}
+
+	resp, err := b.svc.ListObjectsV2(params)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, obj := range resp.Contents {
+		if strings.HasSuffix(*obj.Key, "/") {
+			continue
+		}
+		keys = append(keys, *obj.Key)
+	}
+
+	return keys, nil
+}
+
+// Download saves the content of the object to a file in the given directory and returns the file name
+func (b *LogpushBucket) Download(key string, dir string) (string, error) {
+
+	resp, err := b.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.settings.s3BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	filename := filepath.Join(dir, strings.Replace(key, "/", "_", -1))
+	fh, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	nBytes, err := io.Copy(fh, resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	logp.Debug("logpush", "Downloaded %d bytes from %s", nBytes, key)
+
+	return filename, nil
+}
+
+// Delete removes the object from the bucket
+func (b *LogpushBucket) Delete(key string) error {
+	_, err := b.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(b.settings.s3BucketName),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Tag marks the object as processed with the cloudflarebeat-processed tag
+func (b *LogpushBucket) Tag(key string) error {
+	_, err := b.svc.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket: aws.String(b.settings.s3BucketName),
+		Key:    aws.String(key),
+		Tagging: &s3.Tagging{
+			TagSet: []*s3.Tag{{Key: aws.String(LOGPUSH_PROCESSED_TAG), Value: aws.String("true")}},
+		},
+	})
+	return err
+}
@@ -0,0 +1,171 @@
+package cloudflare
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const UNKNOWN_CATEGORY = "unknown"
+
+// CodeField describes a field of the request logs holding an opaque code, and the human readable category of each
+// of its codes. Codes which aren't listed are published as unknown.
+type CodeField struct {
+	Field      string
+	Target     string
+	Categories map[string]string
+}
+
+// CODE_FIELDS lists the code fields of the request logs which are normalized into a category keyword, next to the
+// raw code. The codes are the ones listed by the Enterprise Log Share schema, to which new ones can be added here.
+var CODE_FIELDS = []CodeField{
+	{
+		Field:  "cache.cacheStatus",
+		Target: "cache.cacheStatusCategory",
+		Categories: map[string]string{
+			"hit":         "hit",
+			"stale":       "hit",
+			"state":       "hit",
+			"updating":    "hit",
+			"revalidated": "hit",
+			"miss":        "miss",
+			"expired":     "expired",
+			"bypass":      "bypass",
+			"ignored":     "bypass",
+			"dynamic":     "dynamic",
+			"unknown":     "dynamic",
+		},
+	},
+	{
+		Field:  "edge.bbResult",
+		Target: "edge.bbResultCategory",
+		Categories: map[string]string{
+			"0":         "allow",
+			"ok":        "allow",
+			"pass":      "allow",
+			"chl":       "challenge",
+			"challenge": "challenge",
+			"ban":       "block",
+			"block":     "block",
+		},
+	},
+	{
+		Field:  "edge.pathingOp",
+		Target: "edge.pathingOpCategory",
+		Categories: map[string]string{
+			"wl":      "allow",
+			"tempOk":  "allow",
+			"chl":     "challenge",
+			"ban":     "block",
+			"errHost": "error",
+		},
+	},
+	{
+		Field:  "edge.pathingSrc",
+		Target: "edge.pathingSrcCategory",
+		Categories: map[string]string{
+			"bic":                 "browser_integrity_check",
+			"err":                 "error",
+			"forced":              "forced",
+			"hot":                 "hotlink_protection",
+			"macro":               "security_level",
+			"skip":                "skip",
+			"sslv":                "ssl_verification",
+			"user":                "user_rule",
+			"filterBasedFirewall": "firewall_rule",
+			"l7ddos":              "ddos_protection",
+			"rateLimit":           "rate_limiting",
+			"waf":                 "waf",
+			"ua":                  "user_agent_rule",
+		},
+	},
+	{
+		Field:  "edge.pathingStatus",
+		Target: "edge.pathingStatusCategory",
+		Categories: map[string]string{
+			"captchaNew":  "challenge_issued",
+			"jschlNew":    "challenge_issued",
+			"captchaOk":   "challenge_passed",
+			"captchaSucc": "challenge_passed",
+			"jschlOk":     "challenge_passed",
+			"jschlSucc":   "challenge_passed",
+			"captchaFail": "challenge_failed",
+			"captchaErr":  "challenge_failed",
+			"jschlFail":   "challenge_failed",
+			"jschlErr":    "challenge_failed",
+			"ip":          "ip_rule",
+			"ipr16":       "ip_rule",
+			"ipr24":       "ip_rule",
+			"reservedIp":  "ip_rule",
+			"reservedIp6": "ip_rule",
+			"ctry":        "country_rule",
+			"badHost":     "ip_reputation",
+			"badOk":       "ip_reputation",
+			"grey":        "ip_reputation",
+			"scan":        "ip_reputation",
+			"se":          "known_service",
+			"mon":         "known_service",
+			"bak":         "known_service",
+			"mob":         "known_service",
+			"aoCrawl":     "known_service",
+			"cdnjs":       "known_service",
+			"wl":          "allowlist",
+			"nr":          "not_rated",
+			"new":         "not_rated",
+			"dnsErr":      "error",
+			"cyclic":      "error",
+			"sniMismatch": "error",
+		},
+	},
+	{
+		Field:  "client.ipClass",
+		Target: "client.ipClassCategory",
+		Categories: map[string]string{
+			"clean":             "clean",
+			"badHost":           "bad_host",
+			"tor":               "tor",
+			"searchEngine":      "bot",
+			"monitoringService": "bot",
+			"securityScanner":   "bot",
+			"backupService":     "bot",
+			"scan":              "scanner",
+			"whitelist":         "allowlisted",
+			"greylist":          "suspicious",
+			"mobilePlatform":    "mobile",
+		},
+	},
+}
+
+// NormalizeCodes adds the category of each of the CODE_FIELDS present in the event, keeping the raw codes
+func NormalizeCodes(evt common.MapStr) {
+	for _, f := range CODE_FIELDS {
+		v, err := evt.GetValue(f.Field)
+		if err != nil {
+			continue
+		}
+		var code string
+		switch c := v.(type) {
+		case string:
+			code = c
+		case float64:
+			code = strconv.FormatFloat(c, 'f', -1, 64)
+		case int64:
+			code = strconv.FormatInt(c, 10)
+		default:
+			continue
+		}
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		evt.Put(f.Target, f.Category(code))
+	}
+}
+
+// Category returns the category of the given code, or unknown if it isn't listed
+func (f CodeField) Category(code string) string {
+	if category, ok := f.Categories[code]; ok {
+		return category
+	}
+	return UNKNOWN_CATEGORY
+}
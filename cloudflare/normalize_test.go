@@ -0,0 +1,146 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestNormalizeCodes(t *testing.T) {
+	evt := common.MapStr{
+		"cache":  map[string]interface{}{"cacheStatus": "revalidated"},
+		"client": map[string]interface{}{"ipClass": "searchEngine"},
+		"edge": map[string]interface{}{
+			"bbResult":      float64(0),
+			"pathingOp":     "chl",
+			"pathingSrc":    "unknown ",
+			"pathingStatus": "jschlNew",
+		},
+	}
+	NormalizeCodes(evt)
+
+	expected := map[string]string{
+		"cache.cacheStatusCategory":  "hit",
+		"client.ipClassCategory":     "bot",
+		"edge.bbResultCategory":      "allow",
+		"edge.pathingOpCategory":     "challenge",
+		"edge.pathingSrcCategory":    "unknown",
+		"edge.pathingStatusCategory": "challenge_issued",
+	}
+	for key, category := range expected {
+		v, err := evt.GetValue(key)
+		if err != nil {
+			t.Errorf("%s isn't set", key)
+		} else if v != category {
+			t.Errorf("%s is %v, expected %s", key, v, category)
+		}
+	}
+
+	// The raw codes are kept
+	if v, _ := evt.GetValue("edge.pathingOp"); v != "chl" {
+		t.Errorf("edge.pathingOp is %v, expected chl", v)
+	}
+}
+
+func TestNormalizeCodesSkipsMissingAndEmptyCodes(t *testing.T) {
+	evt := common.MapStr{
+		"cache": map[string]interface{}{"cacheStatus": ""},
+		"edge":  map[string]interface{}{"pathingOp": nil},
+	}
+	NormalizeCodes(evt)
+
+	for _, f := range CODE_FIELDS {
+		if _, err := evt.GetValue(f.Target); err == nil {
+			t.Errorf("%s is set", f.Target)
+		}
+	}
+}
+
+func TestCodeFieldCategory(t *testing.T) {
+	tests := []struct {
+		field    string
+		code     string
+		category string
+	}{
+		{"cache.cacheStatus", "hit", "hit"},
+		{"cache.cacheStatus", "stale", "hit"},
+		{"cache.cacheStatus", "miss", "miss"},
+		{"cache.cacheStatus", "expired", "expired"},
+		{"cache.cacheStatus", "ignored", "bypass"},
+		{"cache.cacheStatus", "unknown", "dynamic"},
+		{"edge.bbResult", "0", "allow"},
+		{"edge.bbResult", "pass", "allow"},
+		{"edge.bbResult", "chl", "challenge"},
+		{"edge.bbResult", "ban", "block"},
+		{"edge.bbResult", "42", "unknown"},
+		{"edge.pathingOp", "ban", "block"},
+		{"edge.pathingOp", "wl", "allow"},
+		{"edge.pathingSrc", "macro", "security_level"},
+		{"edge.pathingStatus", "ctry", "country_rule"},
+		{"edge.pathingStatus", "captchaFail", "challenge_failed"},
+		{"client.ipClass", "tor", "tor"},
+		{"client.ipClass", "clean", "clean"},
+		{"client.ipClass", "noRecord", "unknown"},
+		{"client.ipClass", "notACode", "unknown"},
+	}
+
+	fields := map[string]CodeField{}
+	for _, f := range CODE_FIELDS {
+		fields[f.Field] = f
+	}
+	for _, test := range tests {
+		if category := fields[test.field].Category(test.code); category != test.category {
+			t.Errorf("The category of %s %s is %s, expected %s", test.field, test.code, category, test.category)
+		}
+	}
+}
+
+// TestCodeFieldsCoverSchema checks that the codes of the Enterprise Log Share schema are all in the lookup tables,
+// so that the tables are updated along with the schema
+func TestCodeFieldsCoverSchema(t *testing.T) {
+	content, err := ioutil.ReadFile("../els_schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(content, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unknown codes, and the ones without a category, are published as unknown
+	uncategorized := map[string]bool{"unknown": true, "undef": true, "noRecord": true, "fint": true}
+
+	checked := 0
+	for _, f := range CODE_FIELDS {
+		property := common.MapStr(schema["properties"].(map[string]interface{}))
+		for _, level := range strings.Split(f.Field, ".") {
+			next, ok := property[level].(map[string]interface{})
+			if !ok {
+				break
+			}
+			if properties, ok := next["properties"].(map[string]interface{}); ok {
+				property = properties
+			} else {
+				property = next
+			}
+		}
+
+		codes, _ := property["enum"].([]interface{})
+		for _, code := range codes {
+			checked++
+			c := strings.TrimSpace(code.(string))
+			if _, ok := f.Categories[c]; !ok && !uncategorized[c] {
+				t.Errorf("The %s code of %s has no category", c, f.Field)
+			}
+		}
+	}
+	if checked == 0 {
+		t.Error("No code was found in the schema")
+	}
+}
@@ -0,0 +1,213 @@
+package cloudflare
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const PRIVACY_REDACTED_VALUE = "REDACTED"
+
+// privacyURIFields are the URIs of the events from which the query parameters are scrubbed
+var privacyURIFields = []string{
+	"clientRequest.uri",
+	"clientRequest.referer",
+	"edgeRequest.uri",
+}
+
+// PrivacyFilter removes the personal data from the events before they're published, by truncating or hashing the
+// client IP, dropping or hashing the cookies and headers, and scrubbing query parameters from the URIs
+type PrivacyFilter struct {
+	clientIP         string
+	cookies          string
+	headers          map[string]bool
+	headersMode      string
+	queryParams      map[string]bool
+	hashKey          []byte
+	ipv4PrefixLength int
+	ipv6PrefixLength int
+}
+
+// NewPrivacyFilter returns a new instance of a PrivacyFilter. The client_ip mode is either none, truncate or hash,
+// the cookies and headers_mode are either none, drop or hash, and hash_key is required by the hash modes.
+func NewPrivacyFilter(params map[string]interface{}) (*PrivacyFilter, error) {
+	f := &PrivacyFilter{
+		clientIP:         params["client_ip"].(string),
+		cookies:          params["cookies"].(string),
+		headers:          map[string]bool{},
+		headersMode:      params["headers_mode"].(string),
+		queryParams:      map[string]bool{},
+		hashKey:          []byte(params["hash_key"].(string)),
+		ipv4PrefixLength: params["ipv4_prefix_length"].(int),
+		ipv6PrefixLength: params["ipv6_prefix_length"].(int),
+	}
+	for _, name := range params["headers"].([]string) {
+		f.headers[strings.ToLower(name)] = true
+	}
+	for _, name := range params["query_params"].([]string) {
+		f.queryParams[name] = true
+	}
+
+	if f.clientIP != "none" && f.clientIP != "truncate" && f.clientIP != "hash" {
+		return nil, fmt.Errorf("Unsupported client IP mode '%s'", f.clientIP)
+	}
+	if f.cookies != "none" && f.cookies != "drop" && f.cookies != "hash" {
+		return nil, fmt.Errorf("Unsupported cookies mode '%s'", f.cookies)
+	}
+	if f.headersMode != "drop" && f.headersMode != "hash" {
+		return nil, fmt.Errorf("Unsupported headers mode '%s'", f.headersMode)
+	}
+	if len(f.hashKey) == 0 && (f.clientIP == "hash" || f.cookies == "hash" || (f.headersMode == "hash" && len(f.headers) > 0)) {
+		return nil, fmt.Errorf("A hash key is required to hash the personal data")
+	}
+	if f.ipv4PrefixLength < 0 || f.ipv4PrefixLength > 32 || f.ipv6PrefixLength < 0 || f.ipv6PrefixLength > 128 {
+		return nil, fmt.Errorf("Invalid IP prefix length")
+	}
+
+	return f, nil
+}
+
+// Enabled returns true if the filter changes anything in the events
+func (f *PrivacyFilter) Enabled() bool {
+	return f.clientIP != "none" || f.cookies != "none" || len(f.headers) > 0 || len(f.queryParams) > 0
+}
+
+// Apply removes the personal data from the event
+func (f *PrivacyFilter) Apply(evt common.MapStr) {
+	switch f.clientIP {
+	case "truncate":
+		if ip, ok := getString(evt, "client.ip"); ok && ip != "" {
+			evt.Put("client.ip", f.truncateIP(ip))
+		}
+	case "hash":
+		// The hash can't be indexed as an ip field, so it's published in its own field
+		if ip := popValue(evt, "client.ip"); ip != nil {
+			evt.Put("client.ipHash", f.hash(fmt.Sprint(ip)))
+		}
+	}
+
+	switch f.cookies {
+	case "drop":
+		evt.Delete("clientRequest.cookies")
+		evt.Delete("edgeResponse.setCookies")
+	case "hash":
+		for _, key := range []string{"clientRequest.cookies", "edgeResponse.setCookies"} {
+			if v, err := evt.GetValue(key); err == nil && v != nil {
+				evt.Put(key, f.hashValues(v, nil))
+			}
+		}
+	}
+
+	if len(f.headers) > 0 {
+		for _, object := range HEADER_OBJECTS {
+			key := object + ".headers"
+			if v, err := evt.GetValue(key); err == nil && v != nil {
+				evt.Put(key, f.hashValues(v, f.headers))
+			}
+		}
+	}
+
+	if len(f.queryParams) > 0 {
+		for _, key := range privacyURIFields {
+			if uri, ok := getString(evt, key); ok && strings.IndexByte(uri, '?') >= 0 {
+				evt.Put(key, f.scrubQueryParams(uri))
+			}
+		}
+	}
+}
+
+// truncateIP zeroes the host part of the IP, keeping the configured prefix length
+func (f *PrivacyFilter) truncateIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(f.ipv4PrefixLength, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(f.ipv6PrefixLength, 128)).String()
+}
+
+// hash returns the hex encoded HMAC-SHA256 of the value with the hash key
+func (f *PrivacyFilter) hash(value string) string {
+	mac := hmac.New(sha256.New, f.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashValues filters the values of a list of cookies or headers, which are either a list of name and value objects
+// or an object of values by name. All the values are filtered if names is nil, otherwise only the ones with the
+// given lower case names are. Filtered values are dropped with the drop headers mode, and hashed otherwise. When all
+// the values are filtered, the list items which aren't objects are hashed as a whole.
+func (f *PrivacyFilter) hashValues(v interface{}, names map[string]bool) interface{} {
+	drop := names != nil && f.headersMode == "drop"
+	matches := func(name string) bool {
+		return names == nil || names[strings.ToLower(name)]
+	}
+
+	switch values := v.(type) {
+	case []interface{}:
+		filtered := []interface{}{}
+		for _, item := range values {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				if names == nil && item != nil {
+					item = f.hash(fmt.Sprint(item))
+				}
+				filtered = append(filtered, item)
+				continue
+			}
+			name, _ := m["name"].(string)
+			if !matches(name) {
+				filtered = append(filtered, item)
+				continue
+			}
+			if drop {
+				continue
+			}
+			hashed := map[string]interface{}{}
+			for k, x := range m {
+				hashed[k] = x
+			}
+			hashed["value"] = f.hash(fmt.Sprint(m["value"]))
+			filtered = append(filtered, hashed)
+		}
+		return filtered
+	case map[string]interface{}:
+		filtered := map[string]interface{}{}
+		for name, x := range values {
+			if !matches(name) {
+				filtered[name] = x
+			} else if !drop {
+				filtered[name] = f.hash(fmt.Sprint(x))
+			}
+		}
+		return filtered
+	case string:
+		if names == nil {
+			return f.hash(values)
+		}
+	}
+	return v
+}
+
+// scrubQueryParams replaces the values of the configured query parameters of the URI, keeping the rest of it as is
+func (f *PrivacyFilter) scrubQueryParams(uri string) string {
+	i := strings.IndexByte(uri, '?')
+	pairs := strings.Split(uri[i+1:], "&")
+	for n, pair := range pairs {
+		name := pair
+		if j := strings.IndexByte(pair, '='); j >= 0 {
+			name = pair[:j]
+		}
+		if f.queryParams[unescapeURIComponent(name, true)] {
+			pairs[n] = name + "=" + PRIVACY_REDACTED_VALUE
+		}
+	}
+	return uri[:i+1] + strings.Join(pairs, "&")
+}
@@ -0,0 +1,250 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// testPrivacyParams returns the params of a PrivacyFilter which changes nothing, overridden by the given ones
+func testPrivacyParams(params map[string]interface{}) map[string]interface{} {
+	p := map[string]interface{}{
+		"client_ip":          "none",
+		"cookies":            "none",
+		"headers":            []string{},
+		"headers_mode":       "drop",
+		"query_params":       []string{},
+		"hash_key":           "secret",
+		"ipv4_prefix_length": 24,
+		"ipv6_prefix_length": 48,
+	}
+	for k, v := range params {
+		p[k] = v
+	}
+	return p
+}
+
+func newTestPrivacyFilter(t *testing.T, params map[string]interface{}) *PrivacyFilter {
+	f, err := NewPrivacyFilter(testPrivacyParams(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func testHMAC(key string, value string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNewPrivacyFilterValidation(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"client_ip": "mask"},
+		{"cookies": "keep"},
+		{"headers_mode": "none"},
+		{"client_ip": "hash", "hash_key": ""},
+		{"cookies": "hash", "hash_key": ""},
+		{"headers": []string{"authorization"}, "headers_mode": "hash", "hash_key": ""},
+		{"ipv4_prefix_length": 33},
+		{"ipv6_prefix_length": -1},
+	}
+
+	for _, params := range tests {
+		if _, err := NewPrivacyFilter(testPrivacyParams(params)); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestPrivacyFilterTruncateClientIP(t *testing.T) {
+	f := newTestPrivacyFilter(t, map[string]interface{}{"client_ip": "truncate"})
+
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"203.0.113.42", "203.0.113.0"},
+		{"::ffff:203.0.113.42", "203.0.113.0"},
+		{"2001:db8:85a3:8d3:1319:8a2e:370:7348", "2001:db8:85a3::"},
+		{"not an ip", "not an ip"},
+	}
+
+	for _, test := range tests {
+		evt := common.MapStr{"client": common.MapStr{"ip": test.ip}}
+		f.Apply(evt)
+		if ip, _ := evt.GetValue("client.ip"); ip != test.expected {
+			t.Errorf("Expected %s to be truncated to %s, got %v", test.ip, test.expected, ip)
+		}
+	}
+
+	f = newTestPrivacyFilter(t, map[string]interface{}{"client_ip": "truncate", "ipv4_prefix_length": 16, "ipv6_prefix_length": 32})
+	evt := common.MapStr{"client": common.MapStr{"ip": "203.0.113.42"}, "origin": common.MapStr{"ip": "198.51.100.7"}}
+	f.Apply(evt)
+	if ip, _ := evt.GetValue("client.ip"); ip != "203.0.0.0" {
+		t.Errorf("Expected 203.0.0.0, got %v", ip)
+	}
+	if ip, _ := evt.GetValue("origin.ip"); ip != "198.51.100.7" {
+		t.Errorf("Expected the origin IP to be kept, got %v", ip)
+	}
+}
+
+func TestPrivacyFilterHashClientIP(t *testing.T) {
+	f := newTestPrivacyFilter(t, map[string]interface{}{"client_ip": "hash"})
+
+	for _, ip := range []string{"203.0.113.42", "2001:db8::1"} {
+		evt := common.MapStr{"client": common.MapStr{"ip": ip, "port": 443}}
+		f.Apply(evt)
+
+		expected := common.MapStr{"ipHash": testHMAC("secret", ip), "port": 443}
+		if !reflect.DeepEqual(evt["client"], expected) {
+			t.Errorf("Expected client %v, got %v", expected, evt["client"])
+		}
+	}
+
+	evt := common.MapStr{"client": common.MapStr{"port": 443}}
+	f.Apply(evt)
+	if _, err := evt.GetValue("client.ipHash"); err == nil {
+		t.Errorf("Expected no client.ipHash without a client IP")
+	}
+}
+
+func TestPrivacyFilterCookies(t *testing.T) {
+	newEvent := func() common.MapStr {
+		return common.MapStr{
+			"clientRequest": common.MapStr{
+				"cookies": map[string]interface{}{"session": "abc", "theme": "dark"},
+			},
+			"edgeResponse": common.MapStr{
+				"setCookies": []interface{}{
+					map[string]interface{}{"name": "session", "value": "abc", "path": "/"},
+					"malformed",
+				},
+			},
+		}
+	}
+
+	f := newTestPrivacyFilter(t, map[string]interface{}{"cookies": "drop"})
+	evt := newEvent()
+	f.Apply(evt)
+	for _, key := range []string{"clientRequest.cookies", "edgeResponse.setCookies"} {
+		if _, err := evt.GetValue(key); err == nil {
+			t.Errorf("Expected %s to be dropped", key)
+		}
+	}
+
+	f = newTestPrivacyFilter(t, map[string]interface{}{"cookies": "hash"})
+	evt = newEvent()
+	f.Apply(evt)
+
+	cookies, _ := evt.GetValue("clientRequest.cookies")
+	expectedCookies := map[string]interface{}{"session": testHMAC("secret", "abc"), "theme": testHMAC("secret", "dark")}
+	if !reflect.DeepEqual(cookies, expectedCookies) {
+		t.Errorf("Expected cookies %v, got %v", expectedCookies, cookies)
+	}
+
+	setCookies, _ := evt.GetValue("edgeResponse.setCookies")
+	expectedSetCookies := []interface{}{
+		map[string]interface{}{"name": "session", "value": testHMAC("secret", "abc"), "path": "/"},
+		testHMAC("secret", "malformed"),
+	}
+	if !reflect.DeepEqual(setCookies, expectedSetCookies) {
+		t.Errorf("Expected set cookies %v, got %v", expectedSetCookies, setCookies)
+	}
+}
+
+func TestPrivacyFilterHeaders(t *testing.T) {
+	newEvent := func() common.MapStr {
+		return common.MapStr{
+			"clientRequest": common.MapStr{
+				"headers": []interface{}{
+					map[string]interface{}{"name": "Authorization", "value": "Bearer token"},
+					map[string]interface{}{"name": "accept", "value": "*/*"},
+				},
+			},
+			"originResponse": common.MapStr{
+				"headers": map[string]interface{}{"X-Api-Key": "key", "content-type": "text/html"},
+			},
+		}
+	}
+	headers := []string{"Authorization", "x-api-key"}
+
+	f := newTestPrivacyFilter(t, map[string]interface{}{"headers": headers, "headers_mode": "drop"})
+	evt := newEvent()
+	f.Apply(evt)
+	expected := common.MapStr{
+		"clientRequest": common.MapStr{
+			"headers": []interface{}{map[string]interface{}{"name": "accept", "value": "*/*"}},
+		},
+		"originResponse": common.MapStr{
+			"headers": map[string]interface{}{"content-type": "text/html"},
+		},
+	}
+	if !reflect.DeepEqual(evt, expected) {
+		t.Errorf("Expected %v, got %v", expected, evt)
+	}
+
+	f = newTestPrivacyFilter(t, map[string]interface{}{"headers": headers, "headers_mode": "hash"})
+	evt = newEvent()
+	f.Apply(evt)
+	expected = common.MapStr{
+		"clientRequest": common.MapStr{
+			"headers": []interface{}{
+				map[string]interface{}{"name": "Authorization", "value": testHMAC("secret", "Bearer token")},
+				map[string]interface{}{"name": "accept", "value": "*/*"},
+			},
+		},
+		"originResponse": common.MapStr{
+			"headers": map[string]interface{}{"X-Api-Key": testHMAC("secret", "key"), "content-type": "text/html"},
+		},
+	}
+	if !reflect.DeepEqual(evt, expected) {
+		t.Errorf("Expected %v, got %v", expected, evt)
+	}
+}
+
+func TestPrivacyFilterScrubQueryParams(t *testing.T) {
+	f := newTestPrivacyFilter(t, map[string]interface{}{"query_params": []string{"token", "e mail"}})
+
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"/login?token=abc&page=2", "/login?token=REDACTED&page=2"},
+		{"/login?page=2&token=abc&token=def", "/login?page=2&token=REDACTED&token=REDACTED"},
+		{"/login?token", "/login?token=REDACTED"},
+		{"/login?%74oken=abc", "/login?%74oken=REDACTED"},
+		{"/login?e+mail=a%40b.c&e%20mail=d", "/login?e+mail=REDACTED&e%20mail=REDACTED"},
+		{"/login?token%=abc&%zz=1", "/login?token%=abc&%zz=1"},
+		{"/login?tokens=abc&&", "/login?tokens=abc&&"},
+		{"/login?", "/login?"},
+	}
+
+	for _, test := range tests {
+		if uri := f.scrubQueryParams(test.uri); uri != test.expected {
+			t.Errorf("Expected %q to be scrubbed as %q, got %q", test.uri, test.expected, uri)
+		}
+	}
+
+	evt := common.MapStr{
+		"clientRequest": common.MapStr{"uri": "/a?token=1", "referer": "https://example.com/b?token=2"},
+		"edgeRequest":   common.MapStr{"uri": "/a?token=1"},
+		"originRequest": common.MapStr{"uri": "/a?token=1"},
+	}
+	f.Apply(evt)
+	expected := common.MapStr{
+		"clientRequest": common.MapStr{"uri": "/a?token=REDACTED", "referer": "https://example.com/b?token=REDACTED"},
+		"edgeRequest":   common.MapStr{"uri": "/a?token=REDACTED"},
+		"originRequest": common.MapStr{"uri": "/a?token=1"},
+	}
+	if !reflect.DeepEqual(evt, expected) {
+		t.Errorf("Expected %v, got %v", expected, evt)
+	}
+}
@@ -0,0 +1,32 @@
+package cloudflare
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// RayIDSampler keeps a deterministic sample of the events based on the hash of their Ray ID, so that the same
+// requests are always kept regardless of the input or of how many times they're processed
+type RayIDSampler struct {
+	Rate      float64
+	threshold uint32
+}
+
+// NewRayIDSampler returns a new instance of a RayIDSampler keeping the given ratio of the events, between 0 and 1
+func NewRayIDSampler(rate float64) *RayIDSampler {
+	return &RayIDSampler{
+		Rate:      rate,
+		threshold: uint32(rate * math.MaxUint32),
+	}
+}
+
+// Keep returns true if the event with the given Ray ID is part of the sample. The events without a Ray ID are
+// always kept, as they would otherwise all share the same hash and be either all kept or all dropped.
+func (s *RayIDSampler) Keep(rayID string) bool {
+	if s.Rate >= 1 || rayID == "" {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(rayID))
+	return h.Sum32() < s.threshold
+}
@@ -0,0 +1,46 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRayIDSamplerRate(t *testing.T) {
+	const n = 100000
+	for _, rate := range []float64{0.01, 0.1, 0.5, 0.9} {
+		s := NewRayIDSampler(rate)
+		r := rand.New(rand.NewSource(1))
+		kept := 0
+		for i := 0; i < n; i++ {
+			if s.Keep(fmt.Sprintf("%016x", r.Int63())) {
+				kept++
+			}
+		}
+		if ratio := float64(kept) / n; math.Abs(ratio-rate) > 0.1*rate {
+			t.Errorf("Kept %v of the events with a rate of %v", ratio, rate)
+		}
+	}
+}
+
+func TestRayIDSamplerIsDeterministic(t *testing.T) {
+	a, b := NewRayIDSampler(0.5), NewRayIDSampler(0.5)
+	for i := 0; i < 1000; i++ {
+		rayID := fmt.Sprintf("3a6b5c5d6e7%05x", i)
+		if a.Keep(rayID) != b.Keep(rayID) || a.Keep(rayID) != a.Keep(rayID) {
+			t.Fatalf("Ray ID %s wasn't sampled the same way twice", rayID)
+		}
+	}
+}
+
+func TestRayIDSamplerKeepsEventsWithoutRayID(t *testing.T) {
+	for _, rate := range []float64{0.0001, 0.5} {
+		if !NewRayIDSampler(rate).Keep("") {
+			t.Errorf("The event without a Ray ID was dropped with a rate of %v", rate)
+		}
+	}
+}
@@ -8,12 +8,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/elastic/beats/libbeat/logp"
 )
@@ -24,29 +24,46 @@ const (
 )
 */
 
+var errStateFileNotFound = errors.New("State file not found")
+
 type StateFile struct {
-	FileName    string
-	FilePath    string
-	ZoneName    string
-	StorageType string
-	properties  Properties
-	lastUpdated time.Time
-	s3settings  *awsS3Settings
-	lock        *sync.Mutex
+	FileName       string
+	FilePath       string
+	ZoneName       string
+	StorageType    string
+	legacyFileName string
+	properties     Properties
+	lastUpdated    time.Time
+	s3settings     *awsS3Settings
+	lock           *sync.Mutex
 }
 
 type Properties struct {
-	LastStartTS   int `json:"last_start_ts"`
-	LastEndTS     int `json:"last_end_ts"`
-	LastCount     int `json:"last_count"`
-	LastRequestTS int `json:"last_request_ts"`
-	LastUpdateTS  int `json:"last_update_ts"`
+	Version         int         `json:"version"`
+	LastStartTS     int         `json:"last_start_ts"`
+	LastEndTS       int         `json:"last_end_ts"`
+	LastCount       int         `json:"last_count"`
+	LastRequestTS   int         `json:"last_request_ts"`
+	LastUpdateTS    int         `json:"last_update_ts"`
+	CompletedRanges []TimeRange `json:"completed_ranges"`
+	FailedRanges    []TimeRange `json:"failed_ranges"`
+	Gaps            []TimeRange `json:"gaps"`
+
+	ProcessedFiles  map[string]ProcessedFile `json:"processed_files"`
+	LogpushLastKeys map[string]string        `json:"logpush_last_keys"`
+
+	FirewallEventsLastTS int      `json:"firewall_events_last_ts"`
+	AuditLogsLastWhen    string   `json:"audit_logs_last_when"`
+	AuditLogsLastIDs     []string `json:"audit_logs_last_ids"`
+
+	GraphQLCheckpoints map[string]int `json:"graphql_checkpoints"`
 }
 
-type awsS3Settings struct {
-	awsAccesKey        string
-	awsSecretAccessKey string
-	s3BucketName       string
+// ProcessedFile identifies a local log file which was already processed
+type ProcessedFile struct {
+	Size        int64 `json:"size"`
+	ModTime     int64 `json:"mod_time"`
+	ProcessedTS int   `json:"processed_ts"`
 }
 
 func (p *Properties) ToJsonBytes() []byte {
@@ -56,6 +73,32 @@ func (p *Properties) ToJsonBytes() []byte {
 
 func NewStateFile(config map[string]string) (*StateFile, error) {
 
+	sf, err := newStateFile(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := sf.initialize(); err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// OpenStateFile loads an existing state file without ever creating, migrating or overwriting it, and returns an
+// error if it's missing or can't be parsed
+func OpenStateFile(config map[string]string) (*StateFile, error) {
+
+	sf, err := newStateFile(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := sf.load(); err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+func newStateFile(config map[string]string) (*StateFile, error) {
+
 	sf := &StateFile{
 		StorageType: config["storage_type"],
 	}
@@ -70,7 +113,12 @@ func NewStateFile(config map[string]string) (*StateFile, error) {
 		if _, ok := config["aws_s3_bucket_name"]; !ok {
 			return nil, errors.New("Must specify aws_secret_access_key when using S3 storage.")
 		}
-		sf.s3settings = &awsS3Settings{config["aws_access_key"], config["aws_secret_access_key"], config["aws_s3_bucket_name"]}
+		sf.s3settings = &awsS3Settings{
+			awsAccesKey:        config["aws_access_key"],
+			awsSecretAccessKey: config["aws_secret_access_key"],
+			s3BucketName:       config["aws_s3_bucket_name"],
+			region:             "us-east-1",
+		}
 	} else if _, ok := config["filepath"]; ok {
 		sf.FilePath = config["filepath"]
 	}
@@ -79,120 +127,172 @@ func NewStateFile(config map[string]string) (*StateFile, error) {
 		return nil, errors.New("Must specify zone_tag.")
 	}
 
-	sf.FileName = config["filename"] + "-" + config["zone_tag"] + ".state"
+	sf.FileName = config["filename"] + "-" + config["zone_tag"] + ".json"
+	sf.legacyFileName = config["filename"] + "-" + config["zone_tag"] + ".state"
 
 	sf.lock = &sync.Mutex{}
 
-	sf.initialize()
+	if sf.StorageType != "disk" && sf.StorageType != "s3" {
+		return nil, errors.New("Unsupported storage type")
+	}
 	return sf, nil
 }
 
 func (s *StateFile) initialize() error {
 	logp.Info("Initializing state file '%s' with storage type '%s'", s.FileName, s.StorageType)
-	var err error
-	if s.StorageType == "disk" {
-		err = s.loadFromDisk()
-	} else if s.StorageType == "s3" {
-		err = s.loadFromS3()
-	} else {
-		return errors.New("Unsupported storage type")
-	}
-	if err != nil {
-		return err
-	}
-	return nil
 
-}
-
-func (s *StateFile) initializeStateFileValues() {
-	s.properties.LastUpdateTS = int(time.Now().UTC().Unix())
-}
-
-func (s *StateFile) loadFromDisk() error {
-
-	sfName := filepath.Join(s.FilePath, s.FileName)
+	sfName, sfData, err := s.readCurrentOrLegacy()
 
 	// Create it if it doesn't exist
-	if _, err := os.Stat(sfName); os.IsNotExist(err) {
-		var file, err = os.Create(sfName)
-		defer file.Close()
-		if err != nil {
-			return err
-		}
+	if err == errStateFileNotFound {
 		s.initializeStateFileValues()
 		logp.Info("Saving newly initialized state file.")
 		if err := s.Save(); err != nil {
 			logp.Info("[ERROR] Could not save new state file: %v", err)
 		}
 		return nil
+	} else if err != nil {
+		return err
 	}
 
-	// Now load the file in memory
-	sfData, err := ioutil.ReadFile(sfName)
-	if err != nil {
-		return err
+	p, version, err := migrateProperties(sfData)
+	if err == ErrUnsupportedStateVersion {
+		return fmt.Errorf("State file '%s' has version %d while the latest supported version is %d. Refusing to overwrite it.", sfName, version, STATE_FILE_VERSION)
+	} else if err != nil {
+		// If the state file isn't valid json, keep it so that it can be repaired by hand, then re-create it
+		logp.Err("Could not unmarshal state file '%s': %v", sfName, err)
+		if err := s.backup(sfName, sfData); err != nil {
+			return fmt.Errorf("Could not back up the unreadable state file '%s': %v", sfName, err)
+		}
+		logp.Warn("Saved the unreadable state file as '%s.bak' and created a new one", sfName)
+		s.initializeStateFileValues()
+		return s.Save()
 	}
 
-	var dat Properties
-	if err := json.Unmarshal(sfData, &dat); err != nil {
-		// If the state file isn't valid json, then re-create it
-		if err != nil {
-			logp.Info("[ERROR] Could not unmarshal: %s", err)
-			logp.Info("State file contents: %s", string(sfData))
-			err = os.Remove(sfName)
-			var file, err = os.Create(sfName)
-			defer file.Close()
-			if err != nil {
-				return err
-			}
-			return nil
+	s.properties = p
+
+	if version == STATE_FILE_VERSION && sfName == s.FileName {
+		return nil
+	}
+
+	logp.Info("Migrating state file '%s' from version %d to '%s' with version %d", sfName, version, s.FileName, STATE_FILE_VERSION)
+	if err := s.Save(); err != nil {
+		return err
+	}
+	if sfName != s.FileName {
+		if err := s.remove(sfName); err != nil {
+			logp.Warn("Could not remove legacy state file '%s': %v", sfName, err)
 		}
 	}
 
-	s.properties = dat
+	return nil
+}
+
+// load reads the existing state file into memory, migrating it to the latest version without saving it
+func (s *StateFile) load() error {
+
+	sfName, sfData, err := s.readCurrentOrLegacy()
+	if err == errStateFileNotFound {
+		return fmt.Errorf("State file '%s' not found in %s storage", s.FileName, s.StorageType)
+	} else if err != nil {
+		return err
+	}
+
+	p, version, err := migrateProperties(sfData)
+	if err == ErrUnsupportedStateVersion {
+		return fmt.Errorf("State file '%s' has version %d while the latest supported version is %d", sfName, version, STATE_FILE_VERSION)
+	} else if err != nil {
+		return fmt.Errorf("Could not parse state file '%s': %v", sfName, err)
+	}
 
+	s.properties = p
 	return nil
 }
 
-func (s *StateFile) loadFromS3() error {
+// readCurrentOrLegacy returns the name and raw contents of the state file, falling back on the state file name
+// used prior to the versioned schema
+func (s *StateFile) readCurrentOrLegacy() (string, []byte, error) {
+	sfData, err := s.read(s.FileName)
+	if err == errStateFileNotFound {
+		sfData, err = s.read(s.legacyFileName)
+		return s.legacyFileName, sfData, err
+	}
+	return s.FileName, sfData, err
+}
+
+func (s *StateFile) initializeStateFileValues() {
+	s.properties = Properties{
+		Version:      STATE_FILE_VERSION,
+		LastUpdateTS: int(time.Now().UTC().Unix()),
+	}
+}
+
+// read returns the raw contents of the given state file from the configured storage
+func (s *StateFile) read(name string) ([]byte, error) {
+	if s.StorageType == "s3" {
+		return s.loadFromS3(name)
+	}
+	return s.loadFromDisk(name)
+}
+
+// backup writes a copy of the given state file contents next to it, with the .bak extension
+func (s *StateFile) backup(name string, data []byte) error {
+	if s.StorageType == "s3" {
+		return s.saveToS3(name+".bak", data)
+	}
+	return s.saveToDisk(name+".bak", data)
+}
+
+// remove deletes the given state file from the configured storage
+func (s *StateFile) remove(name string) error {
+	if s.StorageType == "s3" {
+		return s.removeFromS3(name)
+	}
+	return os.Remove(filepath.Join(s.FilePath, name))
+}
+
+func (s *StateFile) loadFromDisk(name string) ([]byte, error) {
+	sfData, err := ioutil.ReadFile(filepath.Join(s.FilePath, name))
+	if os.IsNotExist(err) {
+		return nil, errStateFileNotFound
+	}
+	return sfData, err
+}
+
+func (s *StateFile) loadFromS3(name string) ([]byte, error) {
 
-	s.lock.Lock()
 	svc, err := s.getAwsSession()
 	if err != nil {
-		s.lock.Unlock()
-		return err
+		return nil, err
 	}
 
-	// 1. Check if the file exists and if not, create it
-	// 2. Otherwise, fetch the object's contents, and store it in the local state instance
 	params := &s3.GetObjectInput{
 		Bucket: aws.String(s.s3settings.s3BucketName),
-		Key:    aws.String(s.FileName),
+		Key:    aws.String(name),
 	}
 	resp, err := svc.GetObject(params)
-
-	if err != nil && err.Error() == "NoSuchKey: The specified key does not exist." {
-		// Create the file here as it doesn't exist
-		s.initializeStateFileValues()
-		_ = s.Save()
-		s.lock.Unlock()
-		return err
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchKey" {
+		return nil, errStateFileNotFound
 	} else if err != nil {
-		s.lock.Unlock()
-		return err
+		return nil, err
 	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *StateFile) removeFromS3(name string) error {
 
-	// File was successfully loaded.  Unmarshall into state attribute
-	var p Properties
-	if err := json.Unmarshal([]byte(fmt.Sprint(resp)), &p); err != nil {
-		s.lock.Unlock()
+	svc, err := s.getAwsSession()
+	if err != nil {
 		return err
 	}
 
-	s.properties = p
-	s.lock.Unlock()
-
-	return nil
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.s3settings.s3BucketName),
+		Key:    aws.String(name),
+	})
+	return err
 }
 
 func (s *StateFile) GetLastStartTS() int {
@@ -235,14 +335,247 @@ func (s *StateFile) UpdateLastRequestTS(ts int) {
 	s.lock.Unlock()
 }
 
+// GetProperties returns a copy of the current state properties
+func (s *StateFile) GetProperties() Properties {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.properties
+}
+
+// ImportProperties replaces the current state with the given raw state file contents, which are migrated to the
+// latest version if needed
+func (s *StateFile) ImportProperties(data []byte) error {
+	p, version, err := migrateProperties(data)
+	if err == ErrUnsupportedStateVersion {
+		return fmt.Errorf("Imported state has version %d while the latest supported version is %d", version, STATE_FILE_VERSION)
+	} else if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.properties = p
+	s.lock.Unlock()
+	return nil
+}
+
+// Reset clears all of the state properties
+func (s *StateFile) Reset() {
+	s.lock.Lock()
+	s.initializeStateFileValues()
+	s.lock.Unlock()
+}
+
+// MoveLastEndTS sets the end of the last processed time range. Moving it forward records the skipped time range as
+// a gap, while moving it backward drops the ranges after it so that the logs are fetched again.
+func (s *StateFile) MoveLastEndTS(ts int) {
+	s.lock.Lock()
+	if s.properties.LastEndTS != 0 && ts > s.properties.LastEndTS {
+		skipped := TimeRange{Start: s.properties.LastEndTS + 1, End: ts}
+		s.properties.FailedRanges = subtractRange(s.properties.FailedRanges, skipped)
+		s.properties.Gaps = mergeRanges(append(s.properties.Gaps, skipped))
+	} else if ts < s.properties.LastEndTS {
+		after := TimeRange{Start: ts + 1, End: int(^uint(0) >> 1)}
+		s.properties.CompletedRanges = subtractRange(s.properties.CompletedRanges, after)
+		s.properties.FailedRanges = subtractRange(s.properties.FailedRanges, after)
+		s.properties.Gaps = subtractRange(s.properties.Gaps, after)
+	}
+	s.properties.LastEndTS = ts
+	if s.properties.LastStartTS == 0 || s.properties.LastStartTS > ts {
+		s.properties.LastStartTS = ts
+	}
+	s.lock.Unlock()
+}
+
+// IsFileProcessed returns true if the local file was already processed with the same size and modification time
+func (s *StateFile) IsFileProcessed(path string, size int64, modTime int64) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, ok := s.properties.ProcessedFiles[path]
+	return ok && f.Size == size && f.ModTime == modTime
+}
+
+// MarkFileProcessed records that the local file with the given size and modification time was processed
+func (s *StateFile) MarkFileProcessed(path string, size int64, modTime int64) {
+	s.lock.Lock()
+	if s.properties.ProcessedFiles == nil {
+		s.properties.ProcessedFiles = map[string]ProcessedFile{}
+	}
+	s.properties.ProcessedFiles[path] = ProcessedFile{size, modTime, int(time.Now().UTC().Unix())}
+	s.lock.Unlock()
+}
+
+// GetLogpushLastKey returns the key of the last Logpush object processed under the given prefix
+func (s *StateFile) GetLogpushLastKey(prefix string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.properties.LogpushLastKeys[prefix]
+}
+
+// UpdateLogpushLastKey records the key of the last Logpush object processed under the given prefix
+func (s *StateFile) UpdateLogpushLastKey(prefix string, key string) {
+	s.lock.Lock()
+	if s.properties.LogpushLastKeys == nil {
+		s.properties.LogpushLastKeys = map[string]string{}
+	}
+	s.properties.LogpushLastKeys[prefix] = key
+	s.lock.Unlock()
+}
+
+// GetFirewallEventsLastTS returns the end of the last time range for which the firewall events were collected
+func (s *StateFile) GetFirewallEventsLastTS() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.properties.FirewallEventsLastTS
+}
+
+// UpdateFirewallEventsLastTS records the end of the last time range for which the firewall events were collected
+func (s *StateFile) UpdateFirewallEventsLastTS(ts int) {
+	s.lock.Lock()
+	s.properties.FirewallEventsLastTS = ts
+	s.lock.Unlock()
+}
+
+// GetAuditLogsCheckpoint returns the time of the last published audit log entry, along with the IDs of the
+// entries published with that same time
+func (s *StateFile) GetAuditLogsCheckpoint() (string, []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.properties.AuditLogsLastWhen, append([]string{}, s.properties.AuditLogsLastIDs...)
+}
+
+// UpdateAuditLogsCheckpoint records the time of the last published audit log entry, along with the IDs of the
+// entries published with that same time
+func (s *StateFile) UpdateAuditLogsCheckpoint(when string, ids []string) {
+	s.lock.Lock()
+	s.properties.AuditLogsLastWhen = when
+	s.properties.AuditLogsLastIDs = ids
+	s.lock.Unlock()
+}
+
+// GetGraphQLCheckpoint returns the end of the last time window collected by the given GraphQL query and zone
+func (s *StateFile) GetGraphQLCheckpoint(key string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.properties.GraphQLCheckpoints[key]
+}
+
+// UpdateGraphQLCheckpoint records the end of the last time window collected by the given GraphQL query and zone
+func (s *StateFile) UpdateGraphQLCheckpoint(key string, ts int) {
+	s.lock.Lock()
+	if s.properties.GraphQLCheckpoints == nil {
+		s.properties.GraphQLCheckpoints = map[string]int{}
+	}
+	s.properties.GraphQLCheckpoints[key] = ts
+	s.lock.Unlock()
+}
+
+// MarkRangeCompleted records that all the logs within the given range have been processed
+func (s *StateFile) MarkRangeCompleted(r TimeRange) {
+	s.lock.Lock()
+	r.Attempts = 0
+	s.properties.CompletedRanges = mergeRanges(append(s.properties.CompletedRanges, r))
+	s.properties.FailedRanges = subtractRange(s.properties.FailedRanges, r)
+	s.properties.Gaps = subtractRange(s.properties.Gaps, r)
+	s.lock.Unlock()
+}
+
+// MarkRangeFailed records that the logs within the given range could not be processed so that it can be retried
+// later. Once a range failed maxAttempts times, it's moved to the list of permanent gaps instead.
+func (s *StateFile) MarkRangeFailed(r TimeRange, maxAttempts int) {
+	s.lock.Lock()
+	r.Attempts = 1
+	for _, f := range s.properties.FailedRanges {
+		if f.Overlaps(r) && f.Attempts >= r.Attempts {
+			r.Attempts = f.Attempts + 1
+		}
+	}
+	failed := []TimeRange{r}
+	for _, c := range s.properties.CompletedRanges {
+		failed = subtractRange(failed, c)
+	}
+	s.properties.FailedRanges = subtractRange(s.properties.FailedRanges, r)
+	if maxAttempts > 0 && r.Attempts >= maxAttempts {
+		logp.Warn("Logs between %s failed %d times and will no longer be retried", r, r.Attempts)
+		for _, f := range failed {
+			f.Attempts = 0
+			s.properties.Gaps = mergeRanges(append(s.properties.Gaps, f))
+		}
+	} else {
+		s.properties.FailedRanges = mergeRanges(append(s.properties.FailedRanges, failed...))
+	}
+	s.lock.Unlock()
+}
+
+// GetRetryRanges returns up to maxSegments segments of the failed ranges which are still within the Cloudflare log
+// retention period, split into segments the API accepts and oldest first, so that they're retried before they
+// expire. Failed ranges that have fallen out of the retention period are moved to the list of permanent gaps, and
+// any hole found in between the completed ranges is queued for retry.
+func (s *StateFile) GetRetryRanges(timeNow int, maxSegments int) []TimeRange {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	retentionStart := timeNow - LOG_RETENTION_SECONDS
+
+	holes := holesBetween(s.properties.CompletedRanges)
+	for _, r := range s.properties.FailedRanges {
+		holes = subtractRange(holes, r)
+	}
+	for _, r := range s.properties.Gaps {
+		holes = subtractRange(holes, r)
+	}
+	for _, h := range holes {
+		logp.Warn("Found unprocessed logs between %s, queuing them for retry", h)
+	}
+	failed := append(append([]TimeRange{}, s.properties.FailedRanges...), holes...)
+
+	retry := []TimeRange{}
+	for _, f := range failed {
+		if f.Start < retentionStart {
+			logp.Warn("Logs between %s are beyond the retention period and can no longer be retrieved", f)
+			f.Attempts = 0
+			s.properties.Gaps = mergeRanges(append(s.properties.Gaps, f))
+			continue
+		}
+		retry = append(retry, f)
+	}
+	s.properties.FailedRanges = retry
+
+	// Completed ranges beyond the retention period are no longer needed, except for the most recent one
+	completed := []TimeRange{}
+	for i, c := range s.properties.CompletedRanges {
+		if c.End >= retentionStart || i == len(s.properties.CompletedRanges)-1 {
+			completed = append(completed, c)
+		}
+	}
+	s.properties.CompletedRanges = completed
+
+	segments := SplitLongTimeRanges(retry, MAX_SEGMENT_SECONDS)
+	sort.Sort(timeRanges(segments))
+	if len(segments) > maxSegments {
+		logp.Info("Retrying %d of the %d failed log segments, the others are left for the next periods", maxSegments, len(segments))
+		segments = segments[:maxSegments]
+	}
+	return segments
+}
+
+// GetGaps returns the ranges for which the logs could not be retrieved before the end of the retention period
+func (s *StateFile) GetGaps() []TimeRange {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]TimeRange{}, s.properties.Gaps...)
+}
+
 func (s *StateFile) Save() error {
 
 	var err error
 	s.lock.Lock()
+	s.lastUpdated = time.Now()
+	s.properties.Version = STATE_FILE_VERSION
+	s.properties.LastUpdateTS = int(time.Now().Unix())
+	data := s.properties.ToJsonBytes()
 	if s.StorageType == "disk" {
-		err = s.saveToDisk()
+		err = s.saveToDisk(s.FileName, data)
 	} else if s.StorageType == "s3" {
-		err = s.saveToDisk()
+		err = s.saveToS3(s.FileName, data)
 	}
 	s.lock.Unlock()
 	if err != nil {
@@ -253,20 +586,17 @@ func (s *StateFile) Save() error {
 	return nil
 }
 
-func (s *StateFile) saveToDisk() error {
-
-	s.lastUpdated = time.Now()
-	s.properties.LastUpdateTS = int(time.Now().Unix())
+func (s *StateFile) saveToDisk(name string, data []byte) error {
 
-	// open file using READ & WRITE permission
-	var file, err = os.OpenFile(s.FileName, os.O_RDWR, 0644)
-	defer file.Close()
+	// Write to a temporary file first so that a partial write never corrupts the existing state
+	sfName := filepath.Join(s.FilePath, name)
+	var file, err = os.OpenFile(sfName+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	data, _ := json.Marshal(s.properties)
-	_, err = file.WriteString(string(data))
+	_, err = file.Write(data)
 	if err != nil {
 		return err
 	}
@@ -277,16 +607,16 @@ func (s *StateFile) saveToDisk() error {
 		return err
 	}
 
-	return nil
+	return os.Rename(sfName+".tmp", sfName)
 }
 
-func (s *StateFile) saveToS3() error {
+func (s *StateFile) saveToS3(name string, data []byte) error {
 
 	svc, err := s.getAwsSession()
 	if err != nil {
 		return err
 	}
-	_, err = s.writeToS3(svc)
+	_, err = s.writeToS3(svc, name, data)
 
 	if err != nil {
 		return err
@@ -296,39 +626,14 @@ func (s *StateFile) saveToS3() error {
 }
 
 func (s *StateFile) getAwsSession() (*s3.S3, error) {
-
-	sess := session.New(&aws.Config{
-		Region: aws.String("us-east-1"),
-	})
-
-	/*
-		Or with debugging on:
-		sess := session.New((&aws.Config{
-			Region: aws.String("us-east-1"),
-		}).WithLogLevel(aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors))
-	*/
-
-	token := ""
-	creds := credentials.NewStaticCredentials(s.s3settings.awsAccesKey, s.s3settings.awsSecretAccessKey, token)
-	_, err := creds.Get()
-	if err != nil {
-		logp.Info("[ERROR] AWS Credentials: %v", err)
-		return nil, err
-	}
-
-	svc := s3.New(sess, &aws.Config{
-		Region:      aws.String("us-east-1"),
-		Credentials: creds,
-	})
-
-	return svc, nil
+	return newS3Service(s.s3settings)
 }
 
-func (s *StateFile) writeToS3(svc *s3.S3) (*s3.PutObjectOutput, error) {
+func (s *StateFile) writeToS3(svc *s3.S3, name string, data []byte) (*s3.PutObjectOutput, error) {
 	params := &s3.PutObjectInput{
 		Bucket: aws.String(s.s3settings.s3BucketName), // Required
-		Key:    aws.String(s.FileName),                // Required
-		Body:   bytes.NewReader(s.properties.ToJsonBytes()),
+		Key:    aws.String(name),                      // Required
+		Body:   bytes.NewReader(data),
 	}
 	return svc.PutObject(params)
 }
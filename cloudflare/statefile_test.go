@@ -0,0 +1,244 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestStateFile(t *testing.T, dir string) *StateFile {
+	sf, err := NewStateFile(map[string]string{
+		"filename":     "cloudflarebeat",
+		"filepath":     dir,
+		"zone_tag":     "zone",
+		"storage_type": "disk",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sf
+}
+
+func TestStateFileMigratesLegacyStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	legacy := `{"last_start_ts": 1500000000, "last_end_ts": 1500000600, "last_count": 42, "last_request_ts": 1500002400, "last_update_ts": 1500002400}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "cloudflarebeat-zone.state"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestStateFile(t, dir).GetProperties()
+	if p.Version != STATE_FILE_VERSION {
+		t.Errorf("Version is %d, expected %d", p.Version, STATE_FILE_VERSION)
+	}
+	if p.LastStartTS != 1500000000 || p.LastEndTS != 1500000600 || p.LastCount != 42 {
+		t.Errorf("The last time range wasn't kept: %+v", p)
+	}
+	if expected := []TimeRange{{Start: 1500000000, End: 1500000600}}; !reflect.DeepEqual(p.CompletedRanges, expected) {
+		t.Errorf("The completed ranges are %v, expected %v", p.CompletedRanges, expected)
+	}
+
+	// The migrated state is saved under the new name, and the legacy file is removed
+	if _, err := os.Stat(filepath.Join(dir, "cloudflarebeat-zone.state")); !os.IsNotExist(err) {
+		t.Errorf("The legacy state file wasn't removed: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cloudflarebeat-zone.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Properties
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != STATE_FILE_VERSION || saved.LastEndTS != 1500000600 || len(saved.CompletedRanges) != 1 {
+		t.Errorf("The saved state file is %s", data)
+	}
+}
+
+func TestStateFileKeepsUnreadableStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	corrupt := []byte(`{"version": 1, "last_end_ts": 15000`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "cloudflarebeat-zone.json"), corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := newTestStateFile(t, dir).GetProperties(); p.LastEndTS != 0 {
+		t.Errorf("The state wasn't re-created: %+v", p)
+	}
+	backup, err := ioutil.ReadFile(filepath.Join(dir, "cloudflarebeat-zone.json.bak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != string(corrupt) {
+		t.Errorf("The backup is %s, expected %s", backup, corrupt)
+	}
+}
+
+func TestOpenStateFileIsReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := map[string]string{
+		"filename":     "cloudflarebeat",
+		"filepath":     dir,
+		"zone_tag":     "zone",
+		"storage_type": "disk",
+	}
+	sfPath := filepath.Join(dir, "cloudflarebeat-zone.json")
+
+	if _, err := OpenStateFile(config); err == nil {
+		t.Error("Opening a missing state file didn't fail")
+	}
+	if _, err := os.Stat(sfPath); !os.IsNotExist(err) {
+		t.Errorf("The missing state file was created: %v", err)
+	}
+
+	corrupt := []byte(`{"version": 1, "last_end_ts": 15000`)
+	if err := ioutil.WriteFile(sfPath, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStateFile(config); err == nil {
+		t.Error("Opening an unreadable state file didn't fail")
+	}
+	if data, _ := ioutil.ReadFile(sfPath); string(data) != string(corrupt) {
+		t.Errorf("The unreadable state file was overwritten with %s", data)
+	}
+
+	legacy := `{"last_start_ts": 1500000000, "last_end_ts": 1500000600}`
+	if err := os.Remove(sfPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cloudflarebeat-zone.state"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := OpenStateFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := sf.GetProperties(); p.LastEndTS != 1500000600 || p.Version != STATE_FILE_VERSION {
+		t.Errorf("The legacy state file wasn't loaded: %+v", p)
+	}
+	if _, err := os.Stat(sfPath); !os.IsNotExist(err) {
+		t.Errorf("The migrated state file was saved: %v", err)
+	}
+}
+
+func TestStateFileGivesUpAfterMaxAttempts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sf := newTestStateFile(t, dir)
+	now := 1500000000
+	r := TimeRange{Start: now - 7200, End: now - 3601}
+	for attempt := 1; attempt <= 3; attempt++ {
+		retries := sf.GetRetryRanges(now, 6)
+		if attempt > 1 && !reflect.DeepEqual(retries, []TimeRange{{Start: r.Start, End: r.End, Attempts: attempt - 1}}) {
+			t.Fatalf("Attempt %d: the retried ranges are %v", attempt, retries)
+		}
+		sf.MarkRangeFailed(r, 3)
+	}
+
+	p := sf.GetProperties()
+	if len(p.FailedRanges) != 0 {
+		t.Errorf("The range is still retried after 3 attempts: %v", p.FailedRanges)
+	}
+	if expected := []TimeRange{{Start: r.Start, End: r.End}}; !reflect.DeepEqual(p.Gaps, expected) {
+		t.Errorf("The gaps are %v, expected %v", p.Gaps, expected)
+	}
+}
+
+func TestStateFileRetryRangesAreLimited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sf := newTestStateFile(t, dir)
+	now := 1500000000
+	sf.MarkRangeFailed(TimeRange{Start: now - 10*3600, End: now - 1}, 10)
+	sf.MarkRangeFailed(TimeRange{Start: now - 20*3600, End: now - 18*3600 - 1}, 10)
+
+	retries := sf.GetRetryRanges(now, 3)
+	expected := []TimeRange{
+		{Start: now - 20*3600, End: now - 19*3600 - 1, Attempts: 1},
+		{Start: now - 19*3600, End: now - 18*3600 - 1, Attempts: 1},
+		{Start: now - 10*3600, End: now - 9*3600 - 1, Attempts: 1},
+	}
+	if !reflect.DeepEqual(retries, expected) {
+		t.Errorf("The retried segments are %v, expected the 3 oldest ones %v", retries, expected)
+	}
+}
+
+// TestStateFileRepeatedFailuresStayBounded simulates an API which always fails, and checks that the failed ranges
+// are merged, that the number of segments downloaded per period doesn't grow and that the ranges are eventually
+// given up on
+func TestStateFileRepeatedFailuresStayBounded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const (
+		period          = 600
+		segments        = 6
+		retriesByPeriod = 6
+		maxAttempts     = 5
+	)
+	sf := newTestStateFile(t, dir)
+	start := 1500000000
+	maxFailed := 0
+	for tick := 0; tick < 2*LOG_RETENTION_SECONDS/period; tick++ {
+		now := start + (tick+1)*period
+		downloaded := SplitTimeRange(start+tick*period, start+(tick+1)*period-1, segments)
+		retries := sf.GetRetryRanges(now, retriesByPeriod)
+		if len(retries) > retriesByPeriod {
+			t.Fatalf("Tick %d: %d segments retried", tick, len(retries))
+		}
+		for _, r := range append(downloaded, retries...) {
+			if r.End-r.Start >= MAX_SEGMENT_SECONDS {
+				t.Fatalf("Tick %d: segment %s is longer than an hour", tick, r)
+			}
+			sf.MarkRangeFailed(r, maxAttempts)
+		}
+
+		p := sf.GetProperties()
+		if len(p.FailedRanges) > maxFailed {
+			maxFailed = len(p.FailedRanges)
+		}
+		for _, f := range p.FailedRanges {
+			if f.Attempts >= maxAttempts {
+				t.Fatalf("Tick %d: range %s failed %d times and is still retried", tick, f, f.Attempts)
+			}
+		}
+	}
+
+	if maxFailed > maxAttempts*2 {
+		t.Errorf("Up to %d failed ranges were kept, expected the adjacent ones to be merged", maxFailed)
+	}
+	if gaps := sf.GetGaps(); len(gaps) == 0 {
+		t.Errorf("Expected the ranges which kept failing to be recorded as gaps")
+	}
+}
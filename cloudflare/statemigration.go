@@ -0,0 +1,65 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// STATE_FILE_VERSION is the version of the state file schema written by this release. Adding a field whose zero value
+// is a valid default doesn't require a new version, only changes to the existing fields do.
+const STATE_FILE_VERSION = 1
+
+var ErrUnsupportedStateVersion = errors.New("Unsupported state file version")
+
+// stateMigrations holds the functions upgrading the raw state file properties, where the function
+// at index i upgrades a state file from version i to version i+1
+var stateMigrations = []func(map[string]interface{}){
+	migrateStateV0,
+}
+
+// migrateProperties decodes the raw state file contents and upgrades them to the latest version if needed.
+// The version of the state file as it was found is returned along with the properties.
+func migrateProperties(data []byte) (Properties, int, error) {
+
+	var p Properties
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return p, 0, err
+	}
+
+	// The original state file format didn't have a version field
+	version := 0
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > STATE_FILE_VERSION {
+		return p, version, ErrUnsupportedStateVersion
+	}
+
+	for v := version; v < STATE_FILE_VERSION; v++ {
+		stateMigrations[v](raw)
+		raw["version"] = v + 1
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return p, version, err
+	}
+	if err := json.Unmarshal(migrated, &p); err != nil {
+		return p, version, err
+	}
+
+	return p, version, nil
+}
+
+// migrateStateV0 upgrades the unversioned state file, which only recorded the last processed time range
+func migrateStateV0(raw map[string]interface{}) {
+	if _, ok := raw["completed_ranges"]; ok {
+		return
+	}
+	start, _ := raw["last_start_ts"].(float64)
+	end, _ := raw["last_end_ts"].(float64)
+	if end > 0 {
+		raw["completed_ranges"] = []TimeRange{{Start: int(start), End: int(end)}}
+	}
+}
@@ -0,0 +1,129 @@
+package cloudflare
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MAX_SEGMENT_SECONDS is the longest time range which the Logpull API accepts in a single request
+const MAX_SEGMENT_SECONDS = 60 * 60
+
+// TimeRange is an inclusive interval of unix timestamps (in seconds) for which logs are requested
+type TimeRange struct {
+	Start    int `json:"start"`
+	End      int `json:"end"`
+	Attempts int `json:"attempts,omitempty"`
+}
+
+type timeRanges []TimeRange
+
+func (t timeRanges) Len() int           { return len(t) }
+func (t timeRanges) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t timeRanges) Less(i, j int) bool { return t[i].Start < t[j].Start }
+
+func (r TimeRange) String() string {
+	return fmt.Sprintf("%d to %d", r.Start, r.End)
+}
+
+// Overlaps returns true if both ranges share at least one second
+func (r TimeRange) Overlaps(o TimeRange) bool {
+	return r.Start <= o.End && o.Start <= r.End
+}
+
+// SplitTimeRange divides the interval from timeStart to timeEnd into the given number of consecutive segments
+func SplitTimeRange(timeStart int, timeEnd int, numSegments int) []TimeRange {
+
+	segments := []TimeRange{}
+	segmentSize := (timeEnd - timeStart) / numSegments
+	currTimeStart := timeStart
+	currTimeEnd := currTimeStart + segmentSize
+
+	for i := 0; i < numSegments; i++ {
+		segments = append(segments, TimeRange{Start: currTimeStart, End: currTimeEnd})
+		currTimeStart = currTimeEnd + 1
+		currTimeEnd = currTimeStart + segmentSize
+	}
+
+	return segments
+}
+
+// SplitLongTimeRanges divides each of the ranges which are longer than maxSeconds into consecutive segments of at
+// most maxSeconds, keeping their number of attempts
+func SplitLongTimeRanges(ranges []TimeRange, maxSeconds int) []TimeRange {
+
+	segments := []TimeRange{}
+	for _, r := range ranges {
+		for start := r.Start; start <= r.End; start += maxSeconds {
+			end := start + maxSeconds - 1
+			if end > r.End {
+				end = r.End
+			}
+			segments = append(segments, TimeRange{Start: start, End: end, Attempts: r.Attempts})
+		}
+	}
+
+	return segments
+}
+
+// mergeRanges sorts the ranges and collapses the ones that overlap, or which are directly adjacent and have the same
+// number of attempts, so that the ranges retried more often keep their own count
+func mergeRanges(ranges []TimeRange) []TimeRange {
+
+	if len(ranges) == 0 {
+		return []TimeRange{}
+	}
+
+	sorted := make([]TimeRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Sort(timeRanges(sorted))
+
+	merged := []TimeRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End || (r.Start == last.End+1 && r.Attempts == last.Attempts) {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			if r.Attempts > last.Attempts {
+				last.Attempts = r.Attempts
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// subtractRange removes the interval s from each of the ranges, splitting a range in two when needed
+func subtractRange(ranges []TimeRange, s TimeRange) []TimeRange {
+
+	result := []TimeRange{}
+	for _, r := range ranges {
+		if !r.Overlaps(s) {
+			result = append(result, r)
+			continue
+		}
+		if r.Start < s.Start {
+			result = append(result, TimeRange{Start: r.Start, End: s.Start - 1, Attempts: r.Attempts})
+		}
+		if r.End > s.End {
+			result = append(result, TimeRange{Start: s.End + 1, End: r.End, Attempts: r.Attempts})
+		}
+	}
+
+	return result
+}
+
+// holesBetween returns the intervals that are not covered in between the given sorted and merged ranges
+func holesBetween(ranges []TimeRange) []TimeRange {
+
+	holes := []TimeRange{}
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].Start > ranges[i-1].End+1 {
+			holes = append(holes, TimeRange{Start: ranges[i-1].End + 1, End: ranges[i].Start - 1})
+		}
+	}
+
+	return holes
+}
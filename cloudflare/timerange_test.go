@@ -0,0 +1,155 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []TimeRange
+		expected []TimeRange
+	}{
+		{"empty", nil, []TimeRange{}},
+		{"single", []TimeRange{{Start: 10, End: 20}}, []TimeRange{{Start: 10, End: 20}}},
+		{
+			"overlapping",
+			[]TimeRange{{Start: 10, End: 20}, {Start: 15, End: 30}},
+			[]TimeRange{{Start: 10, End: 30}},
+		},
+		{
+			"adjacent",
+			[]TimeRange{{Start: 10, End: 20}, {Start: 21, End: 30}},
+			[]TimeRange{{Start: 10, End: 30}},
+		},
+		{
+			"contained",
+			[]TimeRange{{Start: 10, End: 40}, {Start: 15, End: 20}},
+			[]TimeRange{{Start: 10, End: 40}},
+		},
+		{
+			"disjoint and unsorted",
+			[]TimeRange{{Start: 50, End: 60}, {Start: 10, End: 20}},
+			[]TimeRange{{Start: 10, End: 20}, {Start: 50, End: 60}},
+		},
+		{
+			"highest attempts kept",
+			[]TimeRange{{Start: 10, End: 20, Attempts: 1}, {Start: 18, End: 30, Attempts: 3}},
+			[]TimeRange{{Start: 10, End: 30, Attempts: 3}},
+		},
+		{
+			"adjacent with different attempts",
+			[]TimeRange{{Start: 10, End: 20, Attempts: 1}, {Start: 21, End: 30, Attempts: 2}, {Start: 31, End: 40, Attempts: 2}},
+			[]TimeRange{{Start: 10, End: 20, Attempts: 1}, {Start: 21, End: 40, Attempts: 2}},
+		},
+	}
+
+	for _, test := range tests {
+		if merged := mergeRanges(test.ranges); !reflect.DeepEqual(merged, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.name, merged, test.expected)
+		}
+	}
+}
+
+func TestSubtractRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []TimeRange
+		s        TimeRange
+		expected []TimeRange
+	}{
+		{"empty", nil, TimeRange{Start: 10, End: 20}, []TimeRange{}},
+		{
+			"disjoint",
+			[]TimeRange{{Start: 10, End: 20}},
+			TimeRange{Start: 30, End: 40},
+			[]TimeRange{{Start: 10, End: 20}},
+		},
+		{
+			"adjacent",
+			[]TimeRange{{Start: 10, End: 20}},
+			TimeRange{Start: 21, End: 40},
+			[]TimeRange{{Start: 10, End: 20}},
+		},
+		{
+			"overlapping the start",
+			[]TimeRange{{Start: 10, End: 20}},
+			TimeRange{Start: 5, End: 12},
+			[]TimeRange{{Start: 13, End: 20}},
+		},
+		{
+			"overlapping the end",
+			[]TimeRange{{Start: 10, End: 20}},
+			TimeRange{Start: 18, End: 25},
+			[]TimeRange{{Start: 10, End: 17}},
+		},
+		{
+			"contained",
+			[]TimeRange{{Start: 10, End: 20, Attempts: 2}},
+			TimeRange{Start: 13, End: 15},
+			[]TimeRange{{Start: 10, End: 12, Attempts: 2}, {Start: 16, End: 20, Attempts: 2}},
+		},
+		{
+			"containing",
+			[]TimeRange{{Start: 10, End: 20}, {Start: 30, End: 40}},
+			TimeRange{Start: 0, End: 35},
+			[]TimeRange{{Start: 36, End: 40}},
+		},
+	}
+
+	for _, test := range tests {
+		if result := subtractRange(test.ranges, test.s); !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.name, result, test.expected)
+		}
+	}
+}
+
+func TestHolesBetween(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []TimeRange
+		expected []TimeRange
+	}{
+		{"empty", nil, []TimeRange{}},
+		{"single", []TimeRange{{Start: 10, End: 20}}, []TimeRange{}},
+		{"adjacent", []TimeRange{{Start: 10, End: 20}, {Start: 21, End: 30}}, []TimeRange{}},
+		{
+			"holes",
+			[]TimeRange{{Start: 10, End: 20}, {Start: 22, End: 30}, {Start: 41, End: 50}},
+			[]TimeRange{{Start: 21, End: 21}, {Start: 31, End: 40}},
+		},
+	}
+
+	for _, test := range tests {
+		if holes := holesBetween(test.ranges); !reflect.DeepEqual(holes, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.name, holes, test.expected)
+		}
+	}
+}
+
+func TestSplitLongTimeRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []TimeRange
+		expected []TimeRange
+	}{
+		{"empty", nil, []TimeRange{}},
+		{"short", []TimeRange{{Start: 0, End: 99}}, []TimeRange{{Start: 0, End: 99}}},
+		{"exact", []TimeRange{{Start: 0, End: 3599}}, []TimeRange{{Start: 0, End: 3599}}},
+		{
+			"long",
+			[]TimeRange{{Start: 0, End: 7300, Attempts: 2}},
+			[]TimeRange{{Start: 0, End: 3599, Attempts: 2}, {Start: 3600, End: 7199, Attempts: 2}, {Start: 7200, End: 7300, Attempts: 2}},
+		},
+	}
+
+	for _, test := range tests {
+		if segments := SplitLongTimeRanges(test.ranges, MAX_SEGMENT_SECONDS); !reflect.DeepEqual(segments, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.name, segments, test.expected)
+		}
+	}
+}
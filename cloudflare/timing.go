@@ -0,0 +1,80 @@
+package cloudflare
+
+import (
+	"math"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// addTimings adds the durations derived from the nanosecond timestamps and response times of the log record to the
+// timing object of the event, in milliseconds with a microsecond precision, as the timestamps of the event are
+// truncated to milliseconds. The total duration of the request at the edge is also set as event.duration, in
+// nanoseconds.
+func addTimings(evt common.MapStr, l map[string]interface{}) {
+	record := common.MapStr(l)
+	edgeStart, edgeEnd := nanoseconds(record, "edge.startTimestamp"), nanoseconds(record, "edge.endTimestamp")
+	cacheStart, cacheEnd := nanoseconds(record, "cache.startTimestamp"), nanoseconds(record, "cache.endTimestamp")
+	cacheResponseTime := nanoseconds(record, "edge.cacheResponseTime")
+	originResponseTime := nanoseconds(record, "origin.responseTime")
+
+	timing := common.MapStr{}
+	edgeDuration := int64(-1)
+	if edgeStart > 0 && edgeEnd >= edgeStart {
+		edgeDuration = edgeEnd - edgeStart
+		timing["edgeDuration"] = milliseconds(edgeDuration)
+		evt.Put("event.duration", edgeDuration)
+	}
+	if cacheStart > 0 && cacheEnd >= cacheStart {
+		timing["cacheDuration"] = milliseconds(cacheEnd - cacheStart)
+	}
+	if cacheResponseTime > 0 {
+		timing["cacheResponseTime"] = milliseconds(cacheResponseTime)
+	}
+	if originResponseTime > 0 {
+		timing["originResponseTime"] = milliseconds(originResponseTime)
+	}
+
+	// The edge overhead is the time spent by the edge itself, excluding the time waiting for the cache, or for the
+	// origin when the cache response time isn't logged
+	if edgeDuration >= 0 {
+		if cacheResponseTime > 0 {
+			if edgeDuration >= cacheResponseTime {
+				timing["edgeOverhead"] = milliseconds(edgeDuration - cacheResponseTime)
+			}
+		} else if originResponseTime > 0 && edgeDuration >= originResponseTime {
+			timing["edgeOverhead"] = milliseconds(edgeDuration - originResponseTime)
+		}
+	}
+
+	// The time to first byte is seen from the edge, from the start of the request until the cache responded to it,
+	// so it doesn't include the network time to the client
+	if edgeStart > 0 && cacheStart >= edgeStart && cacheResponseTime > 0 {
+		timing["timeToFirstByte"] = milliseconds(cacheStart - edgeStart + cacheResponseTime)
+	}
+
+	if len(timing) > 0 {
+		evt["timing"] = timing
+	}
+}
+
+// nanoseconds returns the nanosecond timestamp or duration at the given dotted key of the log record, or 0 if it's
+// not set
+func nanoseconds(record common.MapStr, key string) int64 {
+	v, err := record.GetValue(key)
+	if err != nil {
+		return 0
+	}
+	switch n := v.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// milliseconds converts a duration in nanoseconds to milliseconds, rounded to the microsecond
+func milliseconds(ns int64) float64 {
+	return math.Floor(float64(ns)/float64(time.Microsecond)+0.5) / 1000
+}
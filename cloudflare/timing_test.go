@@ -0,0 +1,125 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const TEST_EDGE_START = int64(1500000000000000000)
+
+func TestAddTimings(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   map[string]interface{}
+		expected common.MapStr
+	}{
+		{
+			name: "all timestamps",
+			record: map[string]interface{}{
+				"edge":   map[string]interface{}{"startTimestamp": TEST_EDGE_START, "endTimestamp": TEST_EDGE_START + 25123456, "cacheResponseTime": int64(20000400)},
+				"cache":  map[string]interface{}{"startTimestamp": TEST_EDGE_START + 2000000, "endTimestamp": TEST_EDGE_START + 23000000},
+				"origin": map[string]interface{}{"responseTime": int64(15500000)},
+			},
+			expected: common.MapStr{
+				"timing": common.MapStr{
+					"edgeDuration":       25.123,
+					"cacheDuration":      21.0,
+					"cacheResponseTime":  20.0,
+					"originResponseTime": 15.5,
+					"edgeOverhead":       5.123,
+					"timeToFirstByte":    22.0,
+				},
+				"event": common.MapStr{"duration": int64(25123456)},
+			},
+		},
+		{
+			name: "decoded JSON numbers",
+			record: map[string]interface{}{
+				"edge":   map[string]interface{}{"startTimestamp": float64(TEST_EDGE_START), "endTimestamp": float64(TEST_EDGE_START + 8192000)},
+				"origin": map[string]interface{}{"responseTime": float64(6000000)},
+			},
+			expected: common.MapStr{
+				"timing": common.MapStr{
+					"edgeDuration":       8.192,
+					"originResponseTime": 6.0,
+					"edgeOverhead":       2.192,
+				},
+				"event": common.MapStr{"duration": int64(8192000)},
+			},
+		},
+		{
+			name:     "missing timestamps",
+			record:   map[string]interface{}{"edge": map[string]interface{}{"startTimestamp": TEST_EDGE_START}},
+			expected: common.MapStr{},
+		},
+		{
+			name: "invalid timestamps",
+			record: map[string]interface{}{
+				"edge": map[string]interface{}{"startTimestamp": "2017-07-14T02:40:00Z", "endTimestamp": TEST_EDGE_START},
+			},
+			expected: common.MapStr{},
+		},
+		{
+			name: "out of order timestamps",
+			record: map[string]interface{}{
+				"edge":   map[string]interface{}{"startTimestamp": TEST_EDGE_START, "endTimestamp": TEST_EDGE_START - 1000, "cacheResponseTime": int64(3000000)},
+				"cache":  map[string]interface{}{"startTimestamp": TEST_EDGE_START - 5000000, "endTimestamp": TEST_EDGE_START - 6000000},
+				"origin": map[string]interface{}{"responseTime": int64(1000000)},
+			},
+			expected: common.MapStr{
+				"timing": common.MapStr{
+					"cacheResponseTime":  3.0,
+					"originResponseTime": 1.0,
+				},
+			},
+		},
+		{
+			name: "cache response time longer than the edge duration",
+			record: map[string]interface{}{
+				"edge":   map[string]interface{}{"startTimestamp": TEST_EDGE_START, "endTimestamp": TEST_EDGE_START + 2000000, "cacheResponseTime": int64(3000000)},
+				"origin": map[string]interface{}{"responseTime": int64(1000000)},
+			},
+			expected: common.MapStr{
+				"timing": common.MapStr{
+					"edgeDuration":       2.0,
+					"cacheResponseTime":  3.0,
+					"originResponseTime": 1.0,
+				},
+				"event": common.MapStr{"duration": int64(2000000)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		evt := common.MapStr{}
+		addTimings(evt, test.record)
+		if !reflect.DeepEqual(evt, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, evt)
+		}
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	tests := []struct {
+		ns       int64
+		expected float64
+	}{
+		{0, 0},
+		{1499, 0.001},
+		{1500, 0.002},
+		{499, 0},
+		{1000000, 1},
+		{123456789, 123.457},
+	}
+
+	for _, test := range tests {
+		if ms := milliseconds(test.ns); ms != test.expected {
+			t.Errorf("Expected %dns to be %vms, got %v", test.ns, test.expected, ms)
+		}
+	}
+}
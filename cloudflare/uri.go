@@ -0,0 +1,165 @@
+package cloudflare
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+var (
+	uriNumericSegment = regexp.MustCompile(`^[0-9]+$`)
+	uriUUIDSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	uriExtension      = regexp.MustCompile(`^[0-9a-zA-Z]{1,10}$`)
+)
+
+// URIParser splits the URIs of the requests into their path, query and extension, so that they can be aggregated
+type URIParser struct {
+	queryParams map[string]bool
+}
+
+// NewURIParser returns a new instance of a URIParser extracting the given query parameters
+func NewURIParser(queryParams []string) *URIParser {
+	p := &URIParser{queryParams: map[string]bool{}}
+	for _, name := range queryParams {
+		p.queryParams[name] = true
+	}
+	return p
+}
+
+// Enrich adds the parsed URI fields next to the uri of the clientRequest and edgeRequest objects of the event
+func (p *URIParser) Enrich(evt common.MapStr) {
+	for _, prefix := range []string{"clientRequest", "edgeRequest"} {
+		v, err := evt.GetValue(prefix + ".uri")
+		if err != nil {
+			continue
+		}
+		uri, _ := v.(string)
+		if uri == "" {
+			continue
+		}
+		for k, v := range p.Parse(uri) {
+			evt.Put(prefix+"."+k, v)
+		}
+	}
+}
+
+// Parse returns the path, pathTemplate, query, queryParams and extension of the given URI. Invalid percent-encoded
+// sequences are kept as is rather than failing the whole URI.
+func (p *URIParser) Parse(uri string) common.MapStr {
+	rawPath, rawQuery := uri, ""
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		rawPath, rawQuery = uri[:i], uri[i+1:]
+	}
+	if i := strings.IndexByte(rawPath, '#'); i >= 0 {
+		rawPath = rawPath[:i]
+	}
+
+	path := unescapeURIComponent(rawPath, false)
+	parsed := common.MapStr{
+		"path":         path,
+		"pathTemplate": templatePath(path),
+	}
+	if ext := pathExtension(path); ext != "" {
+		parsed["extension"] = ext
+	}
+
+	if rawQuery != "" {
+		parsed["query"] = rawQuery
+		if params := p.extractQueryParams(rawQuery); len(params) > 0 {
+			parsed["queryParams"] = params
+		}
+	}
+
+	return parsed
+}
+
+// extractQueryParams returns the values of the allowed query parameters, as a list when there are several
+func (p *URIParser) extractQueryParams(rawQuery string) common.MapStr {
+	params := common.MapStr{}
+	if len(p.queryParams) == 0 {
+		return params
+	}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value := pair, ""
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+		name = unescapeURIComponent(name, true)
+		if !p.queryParams[name] {
+			continue
+		}
+		value = unescapeURIComponent(value, true)
+		switch existing := params[name].(type) {
+		case nil:
+			params[name] = value
+		case string:
+			params[name] = []string{existing, value}
+		case []string:
+			params[name] = append(existing, value)
+		}
+	}
+	return params
+}
+
+// templatePath replaces the numeric and UUID segments of the path with {id} and {uuid}, so that the requests for
+// the different resources of an endpoint share the same template
+func templatePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if uriNumericSegment.MatchString(segment) {
+			segments[i] = "{id}"
+		} else if uriUUIDSegment.MatchString(segment) {
+			segments[i] = "{uuid}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// pathExtension returns the lower case extension of the last segment of the path, or an empty string if it has none
+func pathExtension(path string) string {
+	last := path[strings.LastIndex(path, "/")+1:]
+	i := strings.LastIndex(last, ".")
+	if i <= 0 || !uriExtension.MatchString(last[i+1:]) {
+		return ""
+	}
+	return strings.ToLower(last[i+1:])
+}
+
+// unescapeURIComponent decodes the percent-encoded sequences of s, and the + signs of query components, keeping the
+// invalid sequences as is
+func unescapeURIComponent(s string, query bool) string {
+	if strings.IndexByte(s, '%') < 0 && (!query || strings.IndexByte(s, '+') < 0) {
+		return s
+	}
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '%' && i+2 < len(s) && isHexDigit(s[i+1]) && isHexDigit(s[i+2]):
+			buf = append(buf, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+		case s[i] == '+' && query:
+			buf = append(buf, ' ')
+		default:
+			buf = append(buf, s[i])
+		}
+	}
+	return string(buf)
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
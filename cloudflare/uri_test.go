@@ -0,0 +1,112 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestTemplatePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "/"},
+		{"", ""},
+		{"/api/users/1234", "/api/users/{id}"},
+		{"/api/users/1234/orders/5678/", "/api/users/{id}/orders/{id}/"},
+		{"/api/items/0f8fad5b-d9cb-469f-a165-70867728950e", "/api/items/{uuid}"},
+		{"/api/items/0F8FAD5B-D9CB-469F-A165-70867728950E/details", "/api/items/{uuid}/details"},
+		{"/api/v2/users", "/api/v2/users"},
+		{"/static/1234.js", "/static/1234.js"},
+		{"/api/items/0f8fad5b-d9cb-469f-a165", "/api/items/0f8fad5b-d9cb-469f-a165"},
+	}
+
+	for _, test := range tests {
+		if template := templatePath(test.path); template != test.expected {
+			t.Errorf("Expected the template of %q to be %q, got %q", test.path, test.expected, template)
+		}
+	}
+}
+
+func TestPathExtension(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/", ""},
+		{"", ""},
+		{"/index.html", "html"},
+		{"/static/app.min.JS", "js"},
+		{"/archive.tar.gz", "gz"},
+		{"/v1.2/users", ""},
+		{"/.htaccess", ""},
+		{"/file.", ""},
+		{"/file.with-dash", ""},
+		{"/file.abcdefghijk", ""},
+		{"/README", ""},
+	}
+
+	for _, test := range tests {
+		if ext := pathExtension(test.path); ext != test.expected {
+			t.Errorf("Expected the extension of %q to be %q, got %q", test.path, test.expected, ext)
+		}
+	}
+}
+
+func TestUnescapeURIComponent(t *testing.T) {
+	tests := []struct {
+		s        string
+		query    bool
+		expected string
+	}{
+		{"/plain/path", false, "/plain/path"},
+		{"/caf%C3%A9", false, "/café"},
+		{"/a%2Fb", false, "/a/b"},
+		{"/a+b", false, "/a+b"},
+		{"a+b%20c", true, "a b c"},
+		{"100%", false, "100%"},
+		{"%", true, "%"},
+		{"%4", false, "%4"},
+		{"%zz%41", false, "%zzA"},
+		{"%%41", false, "%A"},
+		{"end%4", true, "end%4"},
+		{"%41", false, "A"},
+	}
+
+	for _, test := range tests {
+		if s := unescapeURIComponent(test.s, test.query); s != test.expected {
+			t.Errorf("Expected %q (query %v) to be unescaped as %q, got %q", test.s, test.query, test.expected, s)
+		}
+	}
+}
+
+func TestURIParserParse(t *testing.T) {
+	p := NewURIParser([]string{"page", "tag"})
+
+	parsed := p.Parse("/api/users/1234/avatar.PNG?page=2&tag=a+b&tag=c%26d&token=secret#top")
+	expected := common.MapStr{
+		"path":         "/api/users/1234/avatar.PNG",
+		"pathTemplate": "/api/users/{id}/avatar.PNG",
+		"extension":    "png",
+		"query":        "page=2&tag=a+b&tag=c%26d&token=secret#top",
+		"queryParams":  common.MapStr{"page": "2", "tag": []string{"a b", "c&d"}},
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("Expected %v, got %v", expected, parsed)
+	}
+
+	parsed = p.Parse("/search%?q=%zz")
+	expected = common.MapStr{
+		"path":         "/search%",
+		"pathTemplate": "/search%",
+		"query":        "q=%zz",
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("Expected %v, got %v", expected, parsed)
+	}
+}
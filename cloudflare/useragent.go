@@ -0,0 +1,259 @@
+package cloudflare
+
+import (
+	"container/list"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// uapRule is an entry of the user_agent_parsers, os_parsers or device_parsers lists of a uap-core regexes.yaml file
+type uapRule struct {
+	Regex             string `config:"regex"`
+	RegexFlag         string `config:"regex_flag"`
+	FamilyReplacement string `config:"family_replacement"`
+	V1Replacement     string `config:"v1_replacement"`
+	V2Replacement     string `config:"v2_replacement"`
+	V3Replacement     string `config:"v3_replacement"`
+	OSReplacement     string `config:"os_replacement"`
+	OSV1Replacement   string `config:"os_v1_replacement"`
+	OSV2Replacement   string `config:"os_v2_replacement"`
+	OSV3Replacement   string `config:"os_v3_replacement"`
+	DeviceReplacement string `config:"device_replacement"`
+}
+
+// uapRegexes is the content of a uap-core regexes.yaml file
+type uapRegexes struct {
+	UserAgentParsers []uapRule `config:"user_agent_parsers"`
+	OSParsers        []uapRule `config:"os_parsers"`
+	DeviceParsers    []uapRule `config:"device_parsers"`
+}
+
+// uapPattern is a compiled rule, along with the replacement of each of its values and the group used when there's none
+type uapPattern struct {
+	re           *regexp.Regexp
+	replacements []string
+	groups       []int
+}
+
+var uapGroupReference = regexp.MustCompile(`\$(\d)`)
+
+// match returns the values extracted from the user agent by the rule, or nil if it doesn't match
+func (p uapPattern) match(ua string) []string {
+	m := p.re.FindStringSubmatch(ua)
+	if m == nil {
+		return nil
+	}
+	values := make([]string, len(p.replacements))
+	for i, replacement := range p.replacements {
+		if replacement != "" {
+			values[i] = strings.TrimSpace(uapGroupReference.ReplaceAllStringFunc(replacement, func(ref string) string {
+				n, _ := strconv.Atoi(ref[1:])
+				if n < len(m) {
+					return m[n]
+				}
+				return ""
+			}))
+		} else if p.groups[i] > 0 && p.groups[i] < len(m) {
+			values[i] = m[p.groups[i]]
+		}
+	}
+	return values
+}
+
+// UserAgent is the browser, operating system and device parsed from a user agent
+type UserAgent struct {
+	Name       string
+	Version    string
+	OSName     string
+	OSVersion  string
+	DeviceName string
+	IsBot      bool
+}
+
+// UserAgentParser parses the user agents with the rules of a uap-core regexes.yaml file, keeping the most recently
+// parsed ones in a LRU cache
+type UserAgentParser struct {
+	agents    []uapPattern
+	os        []uapPattern
+	devices   []uapPattern
+	cacheSize int
+	cache     map[string]*list.Element
+	recent    *list.List
+	lock      sync.Mutex
+}
+
+// uaCacheEntry is an element of the LRU list of the UserAgentParser
+type uaCacheEntry struct {
+	ua     string
+	parsed UserAgent
+}
+
+// NewUserAgentParser returns a new instance of a UserAgentParser using the regexes.yaml file at the given path, or
+// the bundled rules if it's empty
+func NewUserAgentParser(regexesFile string, cacheSize int) (*UserAgentParser, error) {
+	content := []byte(DEFAULT_USER_AGENT_REGEXES)
+	source := "bundled user agent regexes"
+	if regexesFile != "" {
+		var err error
+		if content, err = ioutil.ReadFile(regexesFile); err != nil {
+			return nil, err
+		}
+		source = regexesFile
+	}
+
+	cfg, err := common.NewConfigWithYAML(content, source)
+	if err != nil {
+		return nil, err
+	}
+	var regexes uapRegexes
+	if err := cfg.Unpack(&regexes); err != nil {
+		return nil, err
+	}
+
+	p := &UserAgentParser{
+		cacheSize: cacheSize,
+		cache:     map[string]*list.Element{},
+		recent:    list.New(),
+	}
+	skipped := 0
+	for _, r := range regexes.UserAgentParsers {
+		if pattern, ok := compileUAPRule(r, []string{r.FamilyReplacement, r.V1Replacement, r.V2Replacement, r.V3Replacement}, []int{1, 2, 3, 4}); ok {
+			p.agents = append(p.agents, pattern)
+		} else {
+			skipped++
+		}
+	}
+	for _, r := range regexes.OSParsers {
+		if pattern, ok := compileUAPRule(r, []string{r.OSReplacement, r.OSV1Replacement, r.OSV2Replacement, r.OSV3Replacement}, []int{1, 2, 3, 4}); ok {
+			p.os = append(p.os, pattern)
+		} else {
+			skipped++
+		}
+	}
+	for _, r := range regexes.DeviceParsers {
+		if pattern, ok := compileUAPRule(r, []string{r.DeviceReplacement}, []int{1}); ok {
+			p.devices = append(p.devices, pattern)
+		} else {
+			skipped++
+		}
+	}
+	if skipped > 0 {
+		logp.Info("Skipped %d user agent regexes of %s which aren't supported by Go", skipped, source)
+	}
+
+	return p, nil
+}
+
+// compileUAPRule compiles the regex of the rule, which can fail as some uap-core regexes use Perl only syntax
+func compileUAPRule(r uapRule, replacements []string, groups []int) (uapPattern, bool) {
+	expr := r.Regex
+	if r.RegexFlag == "i" {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		logp.Debug("useragent", "Skipping user agent regex %s: %v", r.Regex, err)
+		return uapPattern{}, false
+	}
+	return uapPattern{re: re, replacements: replacements, groups: groups}, true
+}
+
+// Parse returns the browser, operating system and device of the given user agent
+func (p *UserAgentParser) Parse(ua string) UserAgent {
+	p.lock.Lock()
+	if e, ok := p.cache[ua]; ok {
+		p.recent.MoveToFront(e)
+		p.lock.Unlock()
+		return e.Value.(*uaCacheEntry).parsed
+	}
+	p.lock.Unlock()
+
+	parsed := p.parse(ua)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.cache[ua]; !ok && p.cacheSize > 0 {
+		p.cache[ua] = p.recent.PushFront(&uaCacheEntry{ua: ua, parsed: parsed})
+		if p.recent.Len() > p.cacheSize {
+			oldest := p.recent.Back()
+			p.recent.Remove(oldest)
+			delete(p.cache, oldest.Value.(*uaCacheEntry).ua)
+		}
+	}
+	return parsed
+}
+
+// parse applies the first matching rule of each list to the user agent
+func (p *UserAgentParser) parse(ua string) UserAgent {
+	parsed := UserAgent{Name: "Other", OSName: "Other", DeviceName: "Other"}
+
+	for _, pattern := range p.agents {
+		if v := pattern.match(ua); v != nil {
+			parsed.Name, parsed.Version = v[0], joinVersion(v[1:])
+			break
+		}
+	}
+	for _, pattern := range p.os {
+		if v := pattern.match(ua); v != nil {
+			parsed.OSName, parsed.OSVersion = v[0], joinVersion(v[1:])
+			break
+		}
+	}
+	for _, pattern := range p.devices {
+		if v := pattern.match(ua); v != nil {
+			parsed.DeviceName = v[0]
+			break
+		}
+	}
+
+	// Crawlers are identified as the Spider device by the uap-core rules
+	parsed.IsBot = parsed.DeviceName == "Spider"
+
+	return parsed
+}
+
+// joinVersion joins the version parts up to the first empty one
+func joinVersion(parts []string) string {
+	version := []string{}
+	for _, part := range parts {
+		if part == "" {
+			break
+		}
+		version = append(version, part)
+	}
+	return strings.Join(version, ".")
+}
+
+// Enrich adds the user_agent object to the event, parsed from its clientRequest.userAgent field
+func (p *UserAgentParser) Enrich(evt common.MapStr) {
+	v, err := evt.GetValue("clientRequest.userAgent")
+	if err != nil {
+		return
+	}
+	ua, _ := v.(string)
+	if ua == "" {
+		return
+	}
+
+	parsed := p.Parse(ua)
+	userAgent := common.MapStr{
+		"name":   parsed.Name,
+		"os":     common.MapStr{"name": parsed.OSName},
+		"device": common.MapStr{"name": parsed.DeviceName},
+		"is_bot": parsed.IsBot,
+	}
+	if parsed.Version != "" {
+		userAgent["version"] = parsed.Version
+	}
+	if parsed.OSVersion != "" {
+		userAgent["os"].(common.MapStr)["version"] = parsed.OSVersion
+		userAgent["os"].(common.MapStr)["full"] = parsed.OSName + " " + parsed.OSVersion
+	}
+	evt["user_agent"] = userAgent
+}
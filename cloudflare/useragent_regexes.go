@@ -0,0 +1,83 @@
+package cloudflare
+
+// DEFAULT_USER_AGENT_REGEXES are the rules used when no uap-core regexes.yaml file is configured. They follow the
+// uap-core format and cover the most common browsers, operating systems, devices and crawlers, the first matching
+// rule of each list being used.
+const DEFAULT_USER_AGENT_REGEXES = `
+user_agent_parsers:
+  - regex: '(Googlebot|bingbot|Baiduspider|YandexBot|DuckDuckBot|Applebot|AhrefsBot|SemrushBot|MJ12bot|DotBot|PetalBot|GPTBot|Bytespider|Twitterbot|LinkedInBot|facebookexternalhit)(?:[/ ](\d+)(?:\.(\d+))?(?:\.(\d+))?)?'
+  - regex: '(Yahoo! Slurp)'
+    family_replacement: 'Yahoo! Slurp'
+  - regex: '([\w\-]*(?:bot|crawler|spider))(?:[/ ](\d+)(?:\.(\d+))?(?:\.(\d+))?)?'
+    regex_flag: 'i'
+  - regex: '(curl|Wget|python-requests|Go-http-client|okhttp|Java|PostmanRuntime|axios|node-fetch)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '(Edge|Edg|EdgA|EdgiOS)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Edge'
+  - regex: '(OPR|Opera)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Opera'
+  - regex: '(SamsungBrowser)/(\d+)(?:\.(\d+))?'
+    family_replacement: 'Samsung Internet'
+  - regex: '(YaBrowser)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Yandex Browser'
+  - regex: '(FxiOS)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Firefox iOS'
+  - regex: '(CriOS)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Chrome Mobile iOS'
+  - regex: '(Firefox)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '(Chrome)/(\d+)(?:\.(\d+))?(?:\.(\d+))?[\d.]* Mobile'
+    family_replacement: 'Chrome Mobile'
+  - regex: '(Chrome|Chromium)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '(Version)/(\d+)(?:\.(\d+))?(?:\.(\d+))?.*Mobile.*Safari/'
+    family_replacement: 'Mobile Safari'
+  - regex: '(Version)/(\d+)(?:\.(\d+))?(?:\.(\d+))?.*Safari/'
+    family_replacement: 'Safari'
+  - regex: '(MSIE) (\d+)\.(\d+)'
+    family_replacement: 'IE'
+  - regex: '(Trident)/\d+\.\d+.*rv:(\d+)\.(\d+)'
+    family_replacement: 'IE'
+
+os_parsers:
+  - regex: '(Windows NT 10\.0)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '10'
+  - regex: '(Windows NT 6\.3)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '8'
+    os_v2_replacement: '1'
+  - regex: '(Windows NT 6\.2)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '8'
+  - regex: '(Windows NT 6\.1)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '7'
+  - regex: '(Windows NT 6\.0)'
+    os_replacement: 'Windows'
+    os_v1_replacement: 'Vista'
+  - regex: '(Windows NT 5\.1)'
+    os_replacement: 'Windows'
+    os_v1_replacement: 'XP'
+  - regex: '(Windows)'
+  - regex: '(?:CPU OS|iPhone OS|CPU iPhone OS) (\d+)_(\d+)(?:_(\d+))?'
+    os_replacement: 'iOS'
+    os_v1_replacement: '$1'
+    os_v2_replacement: '$2'
+    os_v3_replacement: '$3'
+  - regex: '(Android)[ /]?(\d+)?(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '(CrOS) [^ ]+ (\d+)\.(\d+)(?:\.(\d+))?'
+    os_replacement: 'Chrome OS'
+  - regex: '(Mac OS X) (\d+)[_.](\d+)(?:[_.](\d+))?'
+  - regex: '(Mac OS X)'
+  - regex: '(Ubuntu|Debian|Fedora|CentOS|Red Hat|FreeBSD|OpenBSD)'
+  - regex: '(Linux)'
+
+device_parsers:
+  - regex: '(bot|crawler|spider|slurp|facebookexternalhit|Bytespider|Mediapartners-Google)'
+    regex_flag: 'i'
+    device_replacement: 'Spider'
+  - regex: '(iPad)'
+  - regex: '(iPod)'
+  - regex: '(iPhone)'
+  - regex: 'Android[^;]*; ([^;)]+?)(?: Build/|\))'
+  - regex: '(Macintosh)'
+    device_replacement: 'Mac'
+`
@@ -0,0 +1,143 @@
+//go:build !integration
+// +build !integration
+
+package cloudflare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestUserAgentParserBundledRulesCompile(t *testing.T) {
+	p, err := NewUserAgentParser("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// None of the bundled rules may be skipped
+	if len(p.agents) != 17 || len(p.os) != 14 || len(p.devices) != 6 {
+		t.Errorf("Expected 17 user agent, 14 OS and 6 device rules, got %d, %d and %d", len(p.agents), len(p.os), len(p.devices))
+	}
+}
+
+func TestUserAgentParserParse(t *testing.T) {
+	p, err := NewUserAgentParser("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ua       string
+		expected UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.109 Safari/537.36",
+			UserAgent{Name: "Chrome", Version: "120.0.6099", OSName: "Windows", OSVersion: "10", DeviceName: "Other"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			UserAgent{Name: "Edge", Version: "120.0.2210", OSName: "Windows", OSVersion: "10", DeviceName: "Other"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+			UserAgent{Name: "Firefox", Version: "121.0", OSName: "Mac OS X", OSVersion: "10.15", DeviceName: "Mac"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1",
+			UserAgent{Name: "Mobile Safari", Version: "17.1.2", OSName: "iOS", OSVersion: "17.1.2", DeviceName: "iPhone"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			UserAgent{Name: "Chrome Mobile", Version: "120.0.6099", OSName: "Android", OSVersion: "14", DeviceName: "Pixel 8"},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgent{Name: "Googlebot", Version: "2.1", OSName: "Other", DeviceName: "Spider", IsBot: true},
+		},
+		{
+			"curl/8.4.0",
+			UserAgent{Name: "curl", Version: "8.4.0", OSName: "Other", DeviceName: "Other"},
+		},
+		{
+			"",
+			UserAgent{Name: "Other", OSName: "Other", DeviceName: "Other"},
+		},
+	}
+
+	for _, test := range tests {
+		if parsed := p.Parse(test.ua); parsed != test.expected {
+			t.Errorf("Expected %q to be parsed as %+v, got %+v", test.ua, test.expected, parsed)
+		}
+	}
+}
+
+func TestUserAgentParserEnrich(t *testing.T) {
+	p, err := NewUserAgentParser("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := common.MapStr{
+		"clientRequest": common.MapStr{"userAgent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0"},
+	}
+	p.Enrich(evt)
+
+	expected := common.MapStr{
+		"name":    "Firefox",
+		"version": "121.0",
+		"os":      common.MapStr{"name": "Mac OS X", "version": "10.15", "full": "Mac OS X 10.15"},
+		"device":  common.MapStr{"name": "Mac"},
+		"is_bot":  false,
+	}
+	if !reflect.DeepEqual(evt["user_agent"], expected) {
+		t.Errorf("Expected user_agent %v, got %v", expected, evt["user_agent"])
+	}
+
+	empty := common.MapStr{"clientRequest": common.MapStr{"userAgent": ""}}
+	p.Enrich(empty)
+	if _, ok := empty["user_agent"]; ok {
+		t.Errorf("Expected no user_agent for an empty user agent")
+	}
+}
+
+func TestUserAgentParserCacheEviction(t *testing.T) {
+	p, err := NewUserAgentParser("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Parse("curl/1.0")
+	p.Parse("curl/2.0")
+	// Using the first one again makes the second one the least recently used
+	p.Parse("curl/1.0")
+	p.Parse("curl/3.0")
+
+	if len(p.cache) != 2 || p.recent.Len() != 2 {
+		t.Fatalf("Expected 2 cached user agents, got %d", len(p.cache))
+	}
+	for _, ua := range []string{"curl/1.0", "curl/3.0"} {
+		if _, ok := p.cache[ua]; !ok {
+			t.Errorf("Expected %s to be cached", ua)
+		}
+	}
+	if _, ok := p.cache["curl/2.0"]; ok {
+		t.Errorf("Expected curl/2.0 to be evicted")
+	}
+	if front := p.recent.Front().Value.(*uaCacheEntry); front.ua != "curl/3.0" || front.parsed.Version != "3.0" {
+		t.Errorf("Expected curl/3.0 to be the most recently used, got %+v", front)
+	}
+}
+
+func TestUserAgentParserWithoutCache(t *testing.T) {
+	p, err := NewUserAgentParser("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Parse("curl/1.0")
+	if len(p.cache) != 0 || p.recent.Len() != 0 {
+		t.Errorf("Expected nothing to be cached with a cache size of 0")
+	}
+}
@@ -60,8 +60,8 @@ func BuildMapStr(logEntry map[string]interface{}) common.MapStr {
 	// ------------------ cacheRequest sub object ---------------------
 	if _, ok := logEntry["cacheRequest"]; ok {
 		entry["cacheRequest"] = map[string]interface{}{}
-		if !isZero(logEntry["cacheRequest"].(map[string]interface{})["headers"]) {
-			entry["cache"].(map[string]interface{})["headers"] = logEntry["cacheRequest"].(map[string]interface{})["headers"]
+		if headers := normalizeHeaders(logEntry["cacheRequest"].(map[string]interface{})["headers"]); headers != nil {
+			entry["cacheRequest"].(map[string]interface{})["headers"] = headers
 		}
 		entry["cacheRequest"].(map[string]interface{})["keepaliveStatus"] = logEntry["cacheRequest"].(map[string]interface{})["keepaliveStatus"]
 	}
@@ -102,10 +102,12 @@ func BuildMapStr(logEntry map[string]interface{}) common.MapStr {
 		entry["clientRequest"].(map[string]interface{})["bytes"] = logEntry["clientRequest"].(map[string]interface{})["bytes"]
 		entry["clientRequest"].(map[string]interface{})["cookies"] = logEntry["clientRequest"].(map[string]interface{})["cookies"]
 		entry["clientRequest"].(map[string]interface{})["flags"] = logEntry["clientRequest"].(map[string]interface{})["flags"]
-		if !isZero(logEntry["clientRequest"].(map[string]interface{})["headers"]) {
-			entry["clientRequest"].(map[string]interface{})["headers"] = logEntry["clientRequest"].(map[string]interface{})["headers"]
+		if headers := normalizeHeaders(logEntry["clientRequest"].(map[string]interface{})["headers"]); headers != nil {
+			entry["clientRequest"].(map[string]interface{})["headers"] = headers
 		}
 		entry["clientRequest"].(map[string]interface{})["httpHost"] = logEntry["clientRequest"].(map[string]interface{})["httpHost"]
+		entry["clientRequest"].(map[string]interface{})["httpMethod"] = logEntry["clientRequest"].(map[string]interface{})["httpMethod"]
+		entry["clientRequest"].(map[string]interface{})["httpProtocol"] = logEntry["clientRequest"].(map[string]interface{})["httpProtocol"]
 		entry["clientRequest"].(map[string]interface{})["uri"] = logEntry["clientRequest"].(map[string]interface{})["uri"]
 		entry["clientRequest"].(map[string]interface{})["referer"] = logEntry["clientRequest"].(map[string]interface{})["referer"]
 		entry["clientRequest"].(map[string]interface{})["userAgent"] = logEntry["clientRequest"].(map[string]interface{})["userAgent"]
@@ -189,8 +191,8 @@ func BuildMapStr(logEntry map[string]interface{}) common.MapStr {
 		entry["edgeRequest"] = map[string]interface{}{}
 		entry["edgeRequest"].(map[string]interface{})["bodyBytes"] = logEntry["edgeRequest"].(map[string]interface{})["bodyBytes"]
 		entry["edgeRequest"].(map[string]interface{})["bytes"] = logEntry["edgeRequest"].(map[string]interface{})["bytes"]
-		if !isZero(logEntry["edgeRequest"].(map[string]interface{})["headers"]) {
-			entry["edgeRequest"].(map[string]interface{})["headers"] = logEntry["edgeRequest"].(map[string]interface{})["headers"]
+		if headers := normalizeHeaders(logEntry["edgeRequest"].(map[string]interface{})["headers"]); headers != nil {
+			entry["edgeRequest"].(map[string]interface{})["headers"] = headers
 		}
 		entry["edgeRequest"].(map[string]interface{})["httpHost"] = logEntry["edgeRequest"].(map[string]interface{})["httpHost"]
 		entry["edgeRequest"].(map[string]interface{})["httpMethod"] = logEntry["edgeRequest"].(map[string]interface{})["httpMethod"]
@@ -205,8 +207,8 @@ func BuildMapStr(logEntry map[string]interface{}) common.MapStr {
 		entry["edgeResponse"].(map[string]interface{})["bytes"] = logEntry["edgeResponse"].(map[string]interface{})["bytes"]
 		entry["edgeResponse"].(map[string]interface{})["compressionRatio"] = logEntry["edgeResponse"].(map[string]interface{})["compressionRatio"]
 		entry["edgeResponse"].(map[string]interface{})["contentType"] = logEntry["edgeResponse"].(map[string]interface{})["contentType"]
-		if !isZero(logEntry["edgeResponse"].(map[string]interface{})["headers"]) {
-			entry["edgeResponse"].(map[string]interface{})["headers"] = logEntry["edgeResponse"].(map[string]interface{})["headers"]
+		if headers := normalizeHeaders(logEntry["edgeResponse"].(map[string]interface{})["headers"]); headers != nil {
+			entry["edgeResponse"].(map[string]interface{})["headers"] = headers
 		}
 		entry["edgeResponse"].(map[string]interface{})["setCookies"] = logEntry["edgeResponse"].(map[string]interface{})["setCookies"]
 		entry["edgeResponse"].(map[string]interface{})["status"] = logEntry["edgeResponse"].(map[string]interface{})["status"]
@@ -234,8 +236,8 @@ func BuildMapStr(logEntry map[string]interface{}) common.MapStr {
 		entry["originResponse"].(map[string]interface{})["bodyBytes"] = logEntry["originResponse"].(map[string]interface{})["bodyBytes"]
 		entry["originResponse"].(map[string]interface{})["bytes"] = logEntry["originResponse"].(map[string]interface{})["bytes"]
 		entry["originResponse"].(map[string]interface{})["flags"] = logEntry["originResponse"].(map[string]interface{})["flags"]
-		if !isZero(logEntry["originResponse"].(map[string]interface{})["headers"]) {
-			entry["originResponse"].(map[string]interface{})["headers"] = logEntry["originResponse"].(map[string]interface{})["headers"]
+		if headers := normalizeHeaders(logEntry["originResponse"].(map[string]interface{})["headers"]); headers != nil {
+			entry["originResponse"].(map[string]interface{})["headers"] = headers
 		}
 		entry["originResponse"].(map[string]interface{})["httpExpires"] = logEntry["originResponse"].(map[string]interface{})["httpExpires"]
 		entry["originResponse"].(map[string]interface{})["httpLastModified"] = logEntry["originResponse"].(map[string]interface{})["httpLastModified"]
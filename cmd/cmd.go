@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/hartfordfive/cloudflarebeat/config"
+)
+
+const DEFAULT_CONFIG_FILE = "cloudflarebeat.yml"
+
+// Commands holds the subcommands that can be run instead of the beat, keyed by their name
+var Commands = map[string]func(args []string) error{
+	"state":  RunState,
+	"rayid":  RunRayID,
+	"fetch":  RunFetch,
+	"fields": RunFields,
+}
+
+// loadConfig reads the cloudflarebeat section of the given configuration file
+func loadConfig(path string) (config.Config, error) {
+
+	cfg := config.DefaultConfig
+
+	rawConfig, err := common.LoadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("Error loading config file: %v", err)
+	}
+
+	if rawConfig.HasField("cloudflarebeat") {
+		sub, err := rawConfig.Child("cloudflarebeat", -1)
+		if err != nil {
+			return cfg, err
+		}
+		if err := sub.Unpack(&cfg); err != nil {
+			return cfg, fmt.Errorf("Error reading config file: %v", err)
+		}
+	}
+
+	return cfg, nil
+}
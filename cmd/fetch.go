@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hartfordfive/cloudflarebeat/beater"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+)
+
+const fetchUsage = `Usage: cloudflarebeat fetch -from TIME -to TIME -out FILE [options]
+
+Downloads the logs of the time range from the ELS API into a single NDJSON file, in timestamp order. The time range
+is downloaded as segments of up to an hour. The file is gzip compressed if its name ends with .gz. The state file is
+left untouched.
+
+Options:
+`
+
+// RunFetch runs the fetch subcommand, which downloads the logs of a time range to a local file
+func RunFetch(args []string) error {
+
+	flags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	configFile := flags.String("c", DEFAULT_CONFIG_FILE, "Configuration file")
+	zoneTag := flags.String("zone", "", "Zone tag of the logs, overriding zone_tag")
+	from := flags.String("from", "", "Start of the time range, in RFC3339 format")
+	to := flags.String("to", "", "End of the time range, in RFC3339 format")
+	outFile := flags.String("out", "", "File to write the logs to, gzip compressed if it ends with .gz")
+	normalize := flags.Bool("normalize", false, "Write the events as they would be published rather than the raw log lines")
+	retries := flags.Int("retries", 3, "Number of times the failed log segments are retried")
+	segments := flags.Int("segments", beater.TOTAL_LOGFILE_SEGMENTS, "Number of one hour log segments downloaded in parallel")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, fetchUsage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || *outFile == "" {
+		flags.Usage()
+		return errors.New("Must specify -from, -to and -out")
+	}
+
+	timeStart, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		return fmt.Errorf("Invalid -from: %v", err)
+	}
+	timeEnd, err := time.Parse(time.RFC3339, *to)
+	if err != nil {
+		return fmt.Errorf("Invalid -to: %v", err)
+	}
+	if !timeEnd.After(timeStart) {
+		return errors.New("-to must be after -from")
+	}
+	if time.Since(timeStart) > cloudflare.LOG_RETENTION_SECONDS*time.Second {
+		return fmt.Errorf("-from is older than the log retention period of %d hours", cloudflare.LOG_RETENTION_SECONDS/3600)
+	}
+	if *segments < 1 {
+		return errors.New("-segments must be at least 1")
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if *zoneTag != "" {
+		cfg.ZoneTag = *zoneTag
+	}
+	if cfg.ZoneTag == "" {
+		return errors.New("Must specify -zone or zone_tag")
+	}
+
+	lc := cloudflare.NewLogConsumer(cfg.Email, cfg.APIKey, *segments, cfg.ProcessedEventsBufferSize, 1)
+	// The normalized events go through the same stages as the ones of the beat, so that no personal data is written
+	if *normalize {
+		if err := beater.ConfigureEventStages(lc, cfg); err != nil {
+			return err
+		}
+	}
+	files, failed := lc.DownloadLogFiles(cfg.ZoneTag, int(timeStart.Unix()), int(timeEnd.Unix()), *retries)
+	defer func() {
+		for _, f := range files {
+			cloudflare.DeleteLogLife(f)
+		}
+	}()
+	if len(failed) > 0 {
+		return fmt.Errorf("Could not download the logs from %v", failed)
+	}
+
+	fh, err := os.Create(*outFile)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var w io.Writer = fh
+	var gz *gzip.Writer
+	if strings.HasSuffix(*outFile, ".gz") {
+		gz = gzip.NewWriter(fh)
+		w = gz
+	}
+
+	written, skipped, err := lc.WriteSortedLogFile(files, w, *normalize)
+	if err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %d log lines to %s\n", written, *outFile)
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d log lines which could not be processed\n", skipped)
+	}
+	return nil
+}
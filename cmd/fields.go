@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+)
+
+const fieldsUsage = `Usage: cloudflarebeat fields [options]
+
+Lists the log fields available for the zone, and checks the configured fields against them and against fields.yml.
+
+Options:
+`
+
+// RunFields runs the fields subcommand, which lists the log fields available for the zone
+func RunFields(args []string) error {
+
+	flags := flag.NewFlagSet("fields", flag.ContinueOnError)
+	configFile := flags.String("c", DEFAULT_CONFIG_FILE, "Configuration file")
+	zoneTag := flags.String("zone", "", "Zone tag, overriding zone_tag")
+	fieldsYml := flags.String("fields-yml", "", "Path of the fields.yml file, by default the one next to the configuration file")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, fieldsUsage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if *zoneTag != "" {
+		cfg.ZoneTag = *zoneTag
+	}
+	if cfg.ZoneTag == "" {
+		return errors.New("Must specify -zone or zone_tag")
+	}
+	if *fieldsYml == "" {
+		*fieldsYml = filepath.Join(filepath.Dir(*configFile), "fields.yml")
+	}
+
+	client := cloudflare.NewClient(map[string]interface{}{
+		"api_key": cfg.APIKey,
+		"email":   cfg.Email,
+		"debug":   cfg.Debug,
+	})
+	available, err := client.GetLogFields(cfg.ZoneTag)
+	if err != nil {
+		return fmt.Errorf("Could not get the available log fields: %v", err)
+	}
+
+	names := []string{}
+	for name := range available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, available[name])
+	}
+	w.Flush()
+
+	mapped, err := cloudflare.LoadFieldsYml(*fieldsYml)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not load %s, the fields are not checked against it: %v\n", *fieldsYml, err)
+	}
+
+	if len(cfg.LogFields) > 0 {
+		if _, err := cloudflare.CheckLogFields(cfg.LogFields); err != nil {
+			return err
+		}
+	}
+
+	report := cloudflare.CheckFields(cfg.LogFields, available, mapped)
+	if len(report.Unmapped) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: fields not mapped in %s: %s\n", *fieldsYml, strings.Join(report.Unmapped, ", "))
+	}
+	if len(report.Unknown) > 0 {
+		return fmt.Errorf("Configured fields not available for zone %s: %s", cfg.ZoneTag, strings.Join(report.Unknown, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/hartfordfive/cloudflarebeat/beater"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+)
+
+const rayIDUsage = `Usage: cloudflarebeat rayid <ray id> [options]
+
+Looks up the log record of the request with the given Ray ID and prints it as the event that would be published.
+
+Options:
+`
+
+// RunRayID runs the rayid subcommand, which looks up the log record of a single request by its Ray ID
+func RunRayID(args []string) error {
+
+	flags := flag.NewFlagSet("rayid", flag.ContinueOnError)
+	configFile := flags.String("c", DEFAULT_CONFIG_FILE, "Configuration file")
+	zoneTag := flags.String("zone", "", "Zone tag of the request, overriding zone_tag")
+	publish := flags.Bool("publish", false, "Also publish the event to the configured output")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, rayIDUsage)
+		flags.PrintDefaults()
+	}
+
+	// Allow the Ray ID to be given before the options
+	rayID := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		rayID, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if rayID == "" {
+		rayID = flags.Arg(0)
+	}
+	if rayID == "" {
+		flags.Usage()
+		return errors.New("Missing Ray ID")
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if *zoneTag != "" {
+		cfg.ZoneTag = *zoneTag
+	}
+	if cfg.ZoneTag == "" {
+		return errors.New("Must specify -zone or zone_tag")
+	}
+
+	client := cloudflare.NewClient(map[string]interface{}{
+		"api_key": cfg.APIKey,
+		"email":   cfg.Email,
+		"debug":   cfg.Debug,
+	})
+	l, err := client.GetLogByRayID(cfg.ZoneTag, rayID)
+	if err == cloudflare.ErrRayIDNotFound {
+		return fmt.Errorf("Ray ID %s not found in the logs of zone %s", rayID, cfg.ZoneTag)
+	} else if err != nil {
+		return fmt.Errorf("Could not look up Ray ID %s: %v", rayID, err)
+	}
+
+	// The event goes through the same stages as the ones of the beat, so that no personal data is published
+	lc := cloudflare.NewLogConsumer(cfg.Email, cfg.APIKey, 1, 1, 1)
+	if err := beater.ConfigureEventStages(lc, cfg); err != nil {
+		return err
+	}
+	evt, err := lc.BuildEnrichedEvent(l)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(evt, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	if *publish {
+		return publishEvents(*configFile, []common.MapStr{evt})
+	}
+	return nil
+}
+
+// publishEvents publishes the events to the output of the given configuration file, by running the beat with a
+// OneShot beater. libbeat resets its -c flag to the default configuration file before parsing the command line, so
+// the command line is replaced with the given configuration file while the beat runs.
+func publishEvents(configFile string, events []common.MapStr) error {
+	path, err := filepath.Abs(configFile)
+	if err != nil {
+		return err
+	}
+
+	args := os.Args
+	os.Args = []string{args[0], "-c", path}
+	defer func() {
+		os.Args = args
+	}()
+	return beat.Run("cloudflarebeat", "", beater.NewOneShot(events))
+}
@@ -0,0 +1,52 @@
+//go:build !integration
+// +build !integration
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestPublishEventsUsesConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudflarebeat-rayid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "rayid.yml")
+	config := fmt.Sprintf(`
+path.home: %q
+logging.to_files: false
+output.file:
+  path: %q
+  filename: events
+`, dir, dir)
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := os.Args
+	if err := publishEvents(configFile, []common.MapStr{{"@timestamp": common.Time{}, "type": "cloudflare", "rayId": "3a1b2c3d4e5f6a7b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(os.Args, " ") != strings.Join(args, " ") {
+		t.Errorf("The command line wasn't restored, got %v", os.Args)
+	}
+
+	// The event is only written to the file output if the given configuration file was loaded
+	data, err := ioutil.ReadFile(filepath.Join(dir, "events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "3a1b2c3d4e5f6a7b") {
+		t.Errorf("The event wasn't published to the output of the configuration file: %s", data)
+	}
+}
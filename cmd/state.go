@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/hartfordfive/cloudflarebeat/beater"
+	"github.com/hartfordfive/cloudflarebeat/cloudflare"
+)
+
+const stateUsage = `Usage: cloudflarebeat state <action> [options]
+
+Actions:
+  show                     Print the state of the configured zone
+  set -last-end-ts TIME    Move the end of the last processed time range to the given RFC3339 time
+  reset -force             Discard the state of the configured zone
+  export [-o FILE]         Write the state as JSON to FILE, or to stdout
+  import FILE              Load the state from a JSON file, or from stdin with -, into the storage
+
+Options:
+`
+
+// RunState runs the state subcommand, which allows inspecting and modifying the state of the configured zone
+func RunState(args []string) error {
+
+	flags := flag.NewFlagSet("state", flag.ContinueOnError)
+	configFile := flags.String("c", DEFAULT_CONFIG_FILE, "Configuration file")
+	storageType := flags.String("storage", "", "State file storage type (disk or s3), overriding state_file_storage_type")
+	jsonOutput := flags.Bool("json", false, "Print the state as JSON")
+	lastEndTS := flags.String("last-end-ts", "", "New end of the last processed time range, in RFC3339 format")
+	outFile := flags.String("o", "", "File to export the state to")
+	force := flags.Bool("force", false, "Skip the sanity checks and confirmations")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, stateUsage)
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("Missing state action")
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if *storageType != "" {
+		cfg.StateFileStorageType = *storageType
+	}
+
+	// Inspecting the state must never create or overwrite the state file
+	var sf *cloudflare.StateFile
+	if action == "show" || action == "export" {
+		sf, err = beater.OpenStateFile(cfg)
+	} else {
+		sf, err = beater.NewStateFile(cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "show":
+		if *jsonOutput {
+			return writeState(os.Stdout, sf)
+		}
+		printState(cfg.ZoneTag, sf)
+		return nil
+
+	case "set":
+		if *lastEndTS == "" {
+			return errors.New("Must specify -last-end-ts")
+		}
+		t, err := time.Parse(time.RFC3339, *lastEndTS)
+		if err != nil {
+			return fmt.Errorf("Invalid -last-end-ts: %v", err)
+		}
+		if err := checkLastEndTS(t, *force); err != nil {
+			return err
+		}
+		previous := sf.GetLastEndTS()
+		sf.MoveLastEndTS(int(t.Unix()))
+		if err := sf.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Moved last_end_ts of zone %s from %s to %s\n", cfg.ZoneTag, formatTS(previous), formatTS(int(t.Unix())))
+		return nil
+
+	case "reset":
+		if !*force {
+			return fmt.Errorf("This will discard the state of zone %s, run again with -force to confirm", cfg.ZoneTag)
+		}
+		sf.Reset()
+		if err := sf.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Reset the state of zone %s\n", cfg.ZoneTag)
+		return nil
+
+	case "export":
+		if *outFile == "" {
+			return writeState(os.Stdout, sf)
+		}
+		fh, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		return writeState(fh, sf)
+
+	case "import":
+		if flags.NArg() != 1 {
+			return errors.New("Must specify the file to import, or - for stdin")
+		}
+		var data []byte
+		if flags.Arg(0) == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(flags.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		if err := sf.ImportProperties(data); err != nil {
+			return err
+		}
+		if err := sf.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Imported the state of zone %s into %s storage\n", cfg.ZoneTag, sf.StorageType)
+		return nil
+	}
+
+	flags.Usage()
+	return fmt.Errorf("Unknown state action '%s'", action)
+}
+
+// checkLastEndTS ensures that the logs following the given time can still be, or can already be, retrieved
+func checkLastEndTS(t time.Time, force bool) error {
+
+	now := time.Now().UTC()
+	if t.After(now) {
+		return errors.New("The last_end_ts can't be set in the future")
+	}
+	if force {
+		return nil
+	}
+	if t.After(now.Add(-beater.OFFSET_PAST_MINUTES * time.Minute)) {
+		return fmt.Errorf("Logs are only available %d minutes after the fact, use -force to set it anyway", beater.OFFSET_PAST_MINUTES)
+	}
+	if t.Before(now.Add(-cloudflare.LOG_RETENTION_SECONDS * time.Second)) {
+		return errors.New("Logs past the retention period can no longer be retrieved, use -force to set it anyway")
+	}
+
+	return nil
+}
+
+func writeState(w *os.File, sf *cloudflare.StateFile) error {
+	data, err := json.MarshalIndent(sf.GetProperties(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func printState(zoneTag string, sf *cloudflare.StateFile) {
+
+	p := sf.GetProperties()
+
+	fmt.Printf("Zone:           %s\n", zoneTag)
+	fmt.Printf("State file:     %s (%s)\n", sf.FileName, sf.StorageType)
+	fmt.Printf("Version:        %d\n", p.Version)
+	fmt.Printf("Last start:     %s\n", formatTS(p.LastStartTS))
+	fmt.Printf("Last end:       %s\n", formatTS(p.LastEndTS))
+	fmt.Printf("Last request:   %s\n", formatTS(p.LastRequestTS))
+	fmt.Printf("Last update:    %s\n", formatTS(p.LastUpdateTS))
+	fmt.Printf("Firewall events: %s\n", formatTS(p.FirewallEventsLastTS))
+	if p.AuditLogsLastWhen != "" {
+		fmt.Printf("Audit logs:     %s (%d entries)\n", p.AuditLogsLastWhen, len(p.AuditLogsLastIDs))
+	} else {
+		fmt.Printf("Audit logs:     never\n")
+	}
+
+	printRanges("Completed ranges", p.CompletedRanges)
+	printRanges("Failed ranges", p.FailedRanges)
+	printRanges("Gaps", p.Gaps)
+
+	fmt.Printf("Processed files: %d\n", len(p.ProcessedFiles))
+	fmt.Printf("Logpush last keys: %d\n", len(p.LogpushLastKeys))
+	for prefix, key := range p.LogpushLastKeys {
+		fmt.Printf("  '%s': %s\n", prefix, key)
+	}
+	fmt.Printf("GraphQL checkpoints: %d\n", len(p.GraphQLCheckpoints))
+	for key, ts := range p.GraphQLCheckpoints {
+		fmt.Printf("  %s: %s\n", key, formatTS(ts))
+	}
+}
+
+func printRanges(title string, ranges []cloudflare.TimeRange) {
+	fmt.Printf("%s: %d\n", title, len(ranges))
+	for _, r := range ranges {
+		if r.Attempts > 0 {
+			fmt.Printf("  %s to %s (%d attempts)\n", formatTS(r.Start), formatTS(r.End), r.Attempts)
+		} else {
+			fmt.Printf("  %s to %s\n", formatTS(r.Start), formatTS(r.End))
+		}
+	}
+}
+
+func formatTS(ts int) string {
+	if ts == 0 {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%d)", time.Unix(int64(ts), 0).UTC().Format(time.RFC3339), ts)
+}
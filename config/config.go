@@ -11,6 +11,62 @@ type Config struct {
 	Email                        string        `config:"email"`
 	APIServiceKey                string        `config:"api_service_key"`
 	ZoneTag                      string        `config:"zone_tag"`
+	InputType                    string        `config:"input_type"`
+	LogFields                    []string      `config:"log_fields"`
+	RetryMaxAttempts             int           `config:"retry_max_attempts"`
+	RetrySegmentsPerPeriod       int           `config:"retry_segments_per_period"`
+	SampleRate                   float64       `config:"sample_rate"`
+	ClientSampleRate             float64       `config:"client_sample_rate"`
+	OutputSchema                 string        `config:"output_schema"`
+	GeoIPCityDatabase            string        `config:"geoip_city_database"`
+	GeoIPASNDatabase             string        `config:"geoip_asn_database"`
+	UserAgentParsingEnabled      bool          `config:"user_agent_parsing_enabled"`
+	UserAgentRegexesFile         string        `config:"user_agent_regexes_file"`
+	UserAgentCacheSize           int           `config:"user_agent_cache_size"`
+	URIParsingEnabled            bool          `config:"uri_parsing_enabled"`
+	URIQueryParams               []string      `config:"uri_query_params"`
+	PrivacyClientIP              string        `config:"privacy_client_ip"`
+	PrivacyIPv4PrefixLength      int           `config:"privacy_ipv4_prefix_length"`
+	PrivacyIPv6PrefixLength      int           `config:"privacy_ipv6_prefix_length"`
+	PrivacyCookies               string        `config:"privacy_cookies"`
+	PrivacyHeaders               []string      `config:"privacy_headers"`
+	PrivacyHeadersMode           string        `config:"privacy_headers_mode"`
+	PrivacyQueryParams           []string      `config:"privacy_query_params"`
+	PrivacyHashKey               string        `config:"privacy_hash_key"`
+	HeadersOther                 string        `config:"headers_other"`
+	FileInputPaths               []string      `config:"file_input_paths"`
+	FileInputWatch               bool          `config:"file_input_watch"`
+	FileInputScanFrequency       time.Duration `config:"file_input_scan_frequency"`
+	LogpushS3BucketName          string        `config:"logpush_s3_bucket_name"`
+	LogpushS3Prefixes            []string      `config:"logpush_s3_prefixes"`
+	LogpushS3Region              string        `config:"logpush_s3_region"`
+	LogpushS3Endpoint            string        `config:"logpush_s3_endpoint"`
+	LogpushS3AfterProcessing     string        `config:"logpush_s3_after_processing"`
+	LogpushS3ScanFrequency       time.Duration `config:"logpush_s3_scan_frequency"`
+	HTTPInputListen              string        `config:"http_input_listen"`
+	HTTPInputPath                string        `config:"http_input_path"`
+	HTTPInputSecretHeader        string        `config:"http_input_secret_header"`
+	HTTPInputSecret              string        `config:"http_input_secret"`
+	HTTPInputUsername            string        `config:"http_input_username"`
+	HTTPInputPassword            string        `config:"http_input_password"`
+	HTTPInputMaxBodySize         int64         `config:"http_input_max_body_size"`
+	HTTPInputSSLCertificate      string        `config:"http_input_ssl_certificate"`
+	HTTPInputSSLKey              string        `config:"http_input_ssl_key"`
+	FirewallEventsEnabled        bool          `config:"firewall_events_enabled"`
+	FirewallEventsPeriod         time.Duration `config:"firewall_events_period"`
+	FirewallEventsDelay          time.Duration `config:"firewall_events_delay"`
+	FirewallEventsPageSize       int           `config:"firewall_events_page_size"`
+	AuditLogsEnabled             bool          `config:"audit_logs_enabled"`
+	AuditLogsAccountID           string        `config:"audit_logs_account_id"`
+	AuditLogsPeriod              time.Duration `config:"audit_logs_period"`
+	AuditLogsPageSize            int           `config:"audit_logs_page_size"`
+	GraphQLEnabled               bool          `config:"graphql_enabled"`
+	GraphQLZoneTags              []string      `config:"graphql_zone_tags"`
+	GraphQLPeriod                time.Duration `config:"graphql_period"`
+	GraphQLDelay                 time.Duration `config:"graphql_delay"`
+	GraphQLMaxWindow             time.Duration `config:"graphql_max_window"`
+	GraphQLMaxLookback           time.Duration `config:"graphql_max_lookback"`
+	GraphQLLimit                 int           `config:"graphql_limit"`
 	StateFileStorageType         string        `config:"state_file_storage_type"`
 	StateFileName                string        `config:"state_file_name"`
 	StateFilePath                string        `config:"state_file_path"`
@@ -19,15 +75,91 @@ type Config struct {
 	AwsS3BucketName              string        `config:"aws_s3_bucket_name"`
 	DeleteLogFileAfterProcessing bool          `config:"delete_logfile_after_processing"`
 	ProcessedEventsBufferSize    int           `config:"processed_events_buffer_size"`
+	DedupByRayID                 bool          `config:"dedup_by_ray_id"`
+	DedupWindow                  time.Duration `config:"dedup_window"`
+	DeadLetterPath               string        `config:"dead_letter_path"`
+	DeadLetterRotateEveryKb      int           `config:"dead_letter_rotate_every_kb"`
+	DeadLetterNumberOfFiles      int           `config:"dead_letter_number_of_files"`
 	Debug                        bool          `config:"debug"`
+
+	GraphQLQueries []GraphQLQuery `config:"graphql_queries"`
+	HeaderRules    []HeaderRule   `config:"header_rules"`
+	FieldRules     []FieldRule    `config:"field_rules"`
+}
+
+// FieldRule is the fields kept, removed and renamed in the events of the given zones, or all of them if none is given
+type FieldRule struct {
+	Zones   []string      `config:"zones"`
+	Include []string      `config:"include"`
+	Exclude []string      `config:"exclude"`
+	Rename  []FieldRename `config:"rename"`
+}
+
+// FieldRename is the new dotted path of a field of the events
+type FieldRename struct {
+	From string `config:"from"`
+	To   string `config:"to"`
+}
+
+// HeaderRule is the allowlist and denylist of the header names of one of the objects of the request logs
+type HeaderRule struct {
+	Object  string   `config:"object"`
+	Include []string `config:"include"`
+	Exclude []string `config:"exclude"`
+}
+
+// GraphQLQuery is a named GraphQL Analytics API query run for each zone by the metrics collector
+type GraphQLQuery struct {
+	Name  string `config:"name"`
+	Query string `config:"query"`
 }
 
 var DefaultConfig = Config{
 	Period:                       10 * time.Minute,
+	InputType:                    "api",
+	RetryMaxAttempts:             10,
+	RetrySegmentsPerPeriod:       6,
+	SampleRate:                   1,
+	ClientSampleRate:             1,
+	OutputSchema:                 "cloudflare",
+	UserAgentCacheSize:           1000,
+	PrivacyClientIP:              "none",
+	PrivacyIPv4PrefixLength:      24,
+	PrivacyIPv6PrefixLength:      48,
+	PrivacyCookies:               "none",
+	PrivacyHeadersMode:           "drop",
+	HeadersOther:                 "drop",
+	FileInputWatch:               false,
+	FileInputScanFrequency:       10 * time.Second,
+	LogpushS3Prefixes:            []string{""},
+	LogpushS3Region:              "us-east-1",
+	LogpushS3AfterProcessing:     "none",
+	LogpushS3ScanFrequency:       1 * time.Minute,
+	HTTPInputListen:              ":8080",
+	HTTPInputPath:                "/",
+	HTTPInputSecretHeader:        "X-Logpush-Secret",
+	HTTPInputMaxBodySize:         100 * 1024 * 1024,
+	FirewallEventsEnabled:        false,
+	FirewallEventsPeriod:         5 * time.Minute,
+	FirewallEventsDelay:          1 * time.Minute,
+	FirewallEventsPageSize:       1000,
+	AuditLogsEnabled:             false,
+	AuditLogsPeriod:              5 * time.Minute,
+	AuditLogsPageSize:            100,
+	GraphQLEnabled:               false,
+	GraphQLPeriod:                5 * time.Minute,
+	GraphQLDelay:                 5 * time.Minute,
+	GraphQLMaxWindow:             1 * time.Hour,
+	GraphQLMaxLookback:           24 * time.Hour,
+	GraphQLLimit:                 10000,
 	StateFileStorageType:         "disk",
 	StateFileName:                "cloudflarebeat",
 	StateFilePath:                "/etc/cloudflarebeat/",
 	DeleteLogFileAfterProcessing: true,
 	ProcessedEventsBufferSize:    1000,
+	DedupByRayID:                 false,
+	DedupWindow:                  2 * time.Minute,
+	DeadLetterRotateEveryKb:      10240,
+	DeadLetterNumberOfFiles:      7,
 	Debug: false,
 }
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/elastic/beats/libbeat/beat"
 
 	"github.com/hartfordfive/cloudflarebeat/beater"
+	"github.com/hartfordfive/cloudflarebeat/cmd"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := cmd.Commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	err := beat.Run("cloudflarebeat", "", beater.New)
 	if err != nil {
 		os.Exit(1)